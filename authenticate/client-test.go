@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"crypto/rand"
 	"lazada/iop-sdk-go/iop"
+	"lazada/pkg/auth"
 	"log"
 	"net/http"
+	"os"
 )
 
 const (
@@ -15,69 +16,60 @@ const (
 )
 
 func main() {
-	http.HandleFunc("/callback", authCallbackHandler)
-
-	// Start the server to handle the callback
-	log.Println("Server started on port 8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-func authCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract the authorization code from the query parameters
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Authorization code not found", http.StatusBadRequest)
-		return
-	}
-	log.Print(code)
-
-	// Step 2: Exchange the authorization code for an access token using the SDK
-	accessToken, err := getAccessToken(code)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error getting access token: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	// Now you can use the access token to interact with the Lazada API
-	log.Printf("Received access token: %s", accessToken)
-
-	// Example: You can use the access token to fetch data or send the token to the frontend
-	w.Write([]byte(fmt.Sprintf("Access Token: %s", accessToken)))
-}
-
-// Exchange the authorization code for an access token using Lazada SDK
-func getAccessToken(code string) (string, error) {
-	// Step 1: Initialize the SDK client with your app credentials
+	// Step 1: Initialize the SDK client with your app credentials, token
+	// calls always go to the auth gateway so the region only selects the
+	// country preselected on the authorize page
 	clientOptions := iop.ClientOptions{
 		APIKey:    clientID,
 		APISecret: clientSecret,
-		// Region:    "MY", // Use the region corresponding to your account (e.g., MY for Malaysia)
+		Region:    "MY",
 	}
-
 	client := iop.NewClient(&clientOptions)
-	client.AddAPIParam("code", code)
+	client.SetCallbackUrl(redirectURI)
 
-	// Step 2: Call the API to exchange the code for an access token
-	getResult, err := client.Execute("/auth/token/create", "POST", nil)
+	// Step 2: Tokens land in the same store the processing service reads
+	tokens, err := iop.NewFileTokenStore(getEnv("LAZADA_TOKEN_STORE", "tokens.json"))
 	if err != nil {
-		log.Printf("error exchanging code for access token: %v", err)
-		return "", err
+		log.Fatalf("Error opening token store: %v", err)
+	}
+
+	onboarding := &auth.Onboarding{
+		Client:       client,
+		Store:        tokens,
+		StateSecret:  stateSecret(),
+		SuccessURL:   getEnv("LAZADA_ONBOARDING_SUCCESS_URL", "/connected"),
+		SecureCookie: true,
 	}
 
-	// Step 3: Assuming the SDK returns a `Data` field containing the response body
-	var result map[string]interface{}
-	if err := json.Unmarshal(getResult.Data, &result); err != nil {
-		log.Printf("error parsing token response: %v", err)
-		return "", err
+	http.HandleFunc("/login", onboarding.HandleLogin)
+	http.HandleFunc("/callback", onboarding.HandleCallback)
+	http.HandleFunc("/connected", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Seller connected, you can close this page."))
+	})
+
+	// Start the server to handle the callback
+	log.Println("Server started on port 8080...")
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+
+// stateSecret reads the key signing the oauth state, a random key is fine
+// for a single instance but pending authorizations are lost on restart
+func stateSecret() []byte {
+	if secret := os.Getenv("LAZADA_STATE_SECRET"); secret != "" {
+		return []byte(secret)
 	}
 
-	// Step 4: Extract the access token from the parsed response
-	accessToken, ok := result["access_token"].(string)
-	if !ok {
-		log.Printf("access token not found in response")
-		return "", fmt.Errorf("access token not found in response")
+	log.Println("LAZADA_STATE_SECRET not set, using a random key")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Error generating state secret: %v", err)
 	}
+	return secret
+}
 
-	// Return the access token
-	return accessToken, nil
+func getEnv(key, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
 }
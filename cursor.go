@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"lazada/iop-sdk-go/iop/jsonfile"
+)
+
+// errCursorNotFound is returned by a CursorStore when no sync ran yet
+var errCursorNotFound = errors.New("cursor not found")
+
+// Cursor is the incremental sync state of one seller and endpoint
+type Cursor struct {
+	Kind     string `json:"kind"`
+	SellerID string `json:"seller_id"`
+	Country  string `json:"country"`
+	// UpdatedAfter is the latest update time of any record synced so far
+	UpdatedAfter time.Time `json:"updated_after"`
+	// Seen holds the update time of the records inside the overlap window
+	// before UpdatedAfter, they are fetched again but only re-emitted once
+	// they changed
+	Seen map[string]time.Time `json:"seen"`
+}
+
+// CursorStore persists cursors keyed by endpoint kind, seller and country
+type CursorStore interface {
+	Get(kind, sellerID, country string) (*Cursor, error)
+	Put(cursor *Cursor) error
+}
+
+// FileCursorStore is a CursorStore backed by a single JSON file, shared
+// with other processes like FileTokenStore
+type FileCursorStore struct {
+	path string
+}
+
+// NewFileCursorStore opens the store at path, the file is created on the
+// first Put if it does not exist yet
+func NewFileCursorStore(path string) (*FileCursorStore, error) {
+	var stored []*Cursor
+	if err := jsonfile.Read(path, &stored); err != nil {
+		return nil, err
+	}
+	return &FileCursorStore{path: path}, nil
+}
+
+func cursorKey(kind, sellerID, country string) string {
+	return kind + "/" + sellerID + "/" + strings.ToUpper(country)
+}
+
+// Get implements CursorStore
+func (s *FileCursorStore) Get(kind, sellerID, country string) (*Cursor, error) {
+	var stored []*Cursor
+	if err := jsonfile.Read(s.path, &stored); err != nil {
+		return nil, err
+	}
+
+	key := cursorKey(kind, sellerID, country)
+	for _, cursor := range stored {
+		if cursorKey(cursor.Kind, cursor.SellerID, cursor.Country) == key {
+			if cursor.Seen == nil {
+				cursor.Seen = map[string]time.Time{}
+			}
+			return cursor, nil
+		}
+	}
+	return nil, errCursorNotFound
+}
+
+// Put implements CursorStore
+func (s *FileCursorStore) Put(cursor *Cursor) error {
+	dup := cursor.copy()
+	dup.Country = strings.ToUpper(dup.Country)
+	key := cursorKey(dup.Kind, dup.SellerID, dup.Country)
+
+	var stored []*Cursor
+	return jsonfile.Update(s.path, &stored, func() error {
+		for i, c := range stored {
+			if cursorKey(c.Kind, c.SellerID, c.Country) == key {
+				stored[i] = dup
+				return nil
+			}
+		}
+		stored = append(stored, dup)
+		return nil
+	})
+}
+
+func (c *Cursor) copy() *Cursor {
+	dup := *c
+	dup.Seen = make(map[string]time.Time, len(c.Seen))
+	for id, t := range c.Seen {
+		dup.Seen[id] = t
+	}
+	return &dup
+}
@@ -3,11 +3,14 @@ module lazada
 go 1.18
 
 require (
-	github.com/labstack/echo/v4 v4.13.0 // indirect
+	github.com/labstack/echo/v4 v4.13.0
+	github.com/tidwall/gjson v1.18.0
+)
+
+require (
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/tidwall/gjson v1.18.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
@@ -0,0 +1,107 @@
+package iop
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors matched by ResponseError through errors.Is
+var (
+	ErrInvalidToken     = errors.New("iop: invalid access token")
+	ErrRateLimited      = errors.New("iop: rate limited")
+	ErrInvalidSignature = errors.New("iop: invalid signature")
+	ErrConfig           = errors.New("iop: invalid client configuration")
+)
+
+var (
+	invalidTokenCodes = map[string]bool{
+		"IllegalAccessToken": true,
+		"InvalidAccessToken": true,
+		"MissingAccessToken": true,
+		"AccessTokenExpired": true,
+	}
+	rateLimitCodes = map[string]bool{
+		"ApiCallLimit": true,
+		"AppCallLimit": true,
+	}
+	invalidSignatureCodes = map[string]bool{
+		"IncompleteSignature": true,
+		"InvalidSignature":    true,
+	}
+)
+
+// ConfigError is returned before any request is sent when the client is
+// not configured well enough to build one
+type ConfigError struct {
+	Message string
+}
+
+// Error implements error
+func (e *ConfigError) Error() string {
+	return "iop: " + e.Message
+}
+
+// Is lets errors.Is match ErrConfig
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrConfig
+}
+
+// ResponseError defines a error response
+type ResponseError struct {
+	Code       string `json:"code"`
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+	RequestID  string `json:"request_id"`
+	StatusCode int    `json:"-"`
+}
+
+// Error implements error
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("iop: http %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("iop: %s: %s (request_id=%s)", e.Code, e.Message, e.RequestID)
+}
+
+// Is lets errors.Is match the sentinel errors against the Lazada code
+func (e *ResponseError) Is(target error) bool {
+	switch target {
+	case ErrInvalidToken:
+		return invalidTokenCodes[e.Code]
+	case ErrRateLimited:
+		return rateLimitCodes[e.Code] || e.StatusCode == http.StatusTooManyRequests
+	case ErrInvalidSignature:
+		return invalidSignatureCodes[e.Code]
+	}
+	return false
+}
+
+// IsInvalidToken reports whether err is caused by a bad or expired token
+func IsInvalidToken(err error) bool {
+	return errors.Is(err, ErrInvalidToken)
+}
+
+// IsRateLimited reports whether err is caused by Lazada throttling
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// IsInvalidSignature reports whether err is caused by a signature mismatch
+func IsInvalidSignature(err error) bool {
+	return errors.Is(err, ErrInvalidSignature)
+}
+
+// err returns a *ResponseError unless the response is a success
+func (r *Response) err(statusCode int) error {
+	if (r.Code == "" || r.Code == "0") && statusCode < http.StatusBadRequest {
+		return nil
+	}
+	return &ResponseError{
+		Code:       r.Code,
+		Type:       r.Type,
+		Message:    r.Message,
+		RequestID:  r.RequestID,
+		StatusCode: statusCode,
+	}
+}
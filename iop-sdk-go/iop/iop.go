@@ -1,19 +1,17 @@
 package iop
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
-	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
 	neturl "net/url"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +33,9 @@ const (
 	// APIGatewayID endpoint
 	APIGatewayID = "https://api.lazada.co.id/rest"
 
+	// APIGatewayAuth serves the /auth/token/* APIs for every region
+	APIGatewayAuth = "https://auth.lazada.com/rest"
+
 	AuthURL = "https://auth.lazada.com/oauth/authorize"
 )
 
@@ -42,32 +43,100 @@ const (
 type ClientOptions struct {
 	APIKey    string
 	APISecret string
-	Region    string
+	Region    Region
+
+	// BaseURL overrides the gateway of every API, including /auth/*, e.g.
+	// to point the client at a staging or local mock gateway
+	BaseURL string
+
+	// HTTPClient, when set, is used as is and the transport and timeout
+	// options below are ignored
+	HTTPClient *http.Client
+	// Transport overrides the round tripper, e.g. for an egress proxy or a
+	// fake transport in tests
+	Transport http.RoundTripper
+	// ConnectTimeout bounds dialing the gateway, it only applies to the
+	// default transport
+	ConnectTimeout time.Duration
+	// ReadTimeout bounds the whole exchange, including reading the response
+	ReadTimeout time.Duration
+
+	// Retry enables retrying transient failures, nil disables it
+	Retry *RetryPolicy
+
+	// Clock returns the time used to stamp requests, time.Now when nil
+	Clock func() time.Time
+
+	// Logger receives request and response logs, nil disables logging
+	Logger Logger
+
+	// Signer selects the sign_method, SignerSHA256 when nil
+	Signer Signer
+
+	// PostParamsInQuery sends the API params of POST requests in the query
+	// string instead of the body
+	PostParamsInQuery bool
+}
+
+// Validate checks the options are enough to build requests
+func (opts *ClientOptions) Validate() error {
+	if opts.APIKey == "" || opts.APISecret == "" {
+		return &ConfigError{Message: "missing API key or secret"}
+	}
+	if opts.BaseURL != "" {
+		return nil
+	}
+	if opts.Region != "" && !opts.Region.Valid() {
+		return errUnknownRegion(string(opts.Region))
+	}
+	return nil
 }
 
 // IopClient represents a client to Lazada
 type IopClient struct {
 	APIKey      string
 	APISecret   string
-	Region      string
+	Region      Region
+	BaseURL     string
 	CallbackURL string
 
 	Method     string
 	SysParams  map[string]string
 	APIParams  map[string]string
 	FileParams map[string][]byte
+	Files      []FileParam
+
+	httpClient  *http.Client
+	retryPolicy *RetryPolicy
+	clock       func() time.Time
+	logger      Logger
+	signer      Signer
+
+	postParamsInQuery bool
 }
 
 // NewClient init
 func NewClient(opts *ClientOptions) *IopClient {
+	signer := opts.Signer
+	if signer == nil {
+		signer = SignerSHA256
+	}
+
 	return &IopClient{
-		Region:    opts.Region,
-		APIKey:    opts.APIKey,
-		APISecret: opts.APISecret,
+		Region:      opts.Region,
+		BaseURL:     opts.BaseURL,
+		APIKey:      opts.APIKey,
+		APISecret:   opts.APISecret,
+		httpClient:  newHTTPClient(opts),
+		retryPolicy: opts.Retry,
+		clock:       opts.Clock,
+		logger:      opts.Logger,
+		signer:      signer,
+
+		postParamsInQuery: opts.PostParamsInQuery,
 		SysParams: map[string]string{
 			"app_key":     opts.APIKey,
-			"sign_method": "sha256",
-			"timestamp":   fmt.Sprintf("%d000", time.Now().Unix()),
+			"sign_method": signer.Method(),
 			"partner_id":  Version,
 		},
 		APIParams:  map[string]string{},
@@ -75,6 +144,81 @@ func NewClient(opts *ClientOptions) *IopClient {
 	}
 }
 
+// newHTTPClient builds the http client described by opts, falling back to
+// http.DefaultClient when nothing is customised
+func newHTTPClient(opts *ClientOptions) *http.Client {
+	if opts.HTTPClient != nil {
+		return opts.HTTPClient
+	}
+	if opts.Transport == nil && opts.ConnectTimeout == 0 && opts.ReadTimeout == 0 {
+		return http.DefaultClient
+	}
+
+	transport := opts.Transport
+	if transport == nil {
+		if opts.ConnectTimeout > 0 {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.DialContext = (&net.Dialer{
+				Timeout:   opts.ConnectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext
+			t.TLSHandshakeTimeout = opts.ConnectTimeout
+			transport = t
+		} else {
+			transport = http.DefaultTransport
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.ReadTimeout,
+	}
+}
+
+// SetHTTPClient setter
+func (lc *IopClient) SetHTTPClient(client *http.Client) *IopClient {
+	lc.httpClient = client
+	return lc
+}
+
+// SetRetryPolicy setter, nil disables retries
+func (lc *IopClient) SetRetryPolicy(policy *RetryPolicy) *IopClient {
+	lc.retryPolicy = policy
+	return lc
+}
+
+// SetSigner setter, also updates the sign_method sent to the gateway
+func (lc *IopClient) SetSigner(signer Signer) *IopClient {
+	lc.signer = signer
+	lc.SysParams["sign_method"] = signer.Method()
+	return lc
+}
+
+// SetLogger setter, nil disables logging
+func (lc *IopClient) SetLogger(logger Logger) *IopClient {
+	lc.logger = logger
+	return lc
+}
+
+// SetClock setter, used to stamp requests with a fixed time in tests
+func (lc *IopClient) SetClock(clock func() time.Time) *IopClient {
+	lc.clock = clock
+	return lc
+}
+
+// timestamp returns the current time in milliseconds as expected by the
+// gateway, every outgoing request is stamped right before it is signed
+func (lc *IopClient) timestamp() string {
+	return strconv.FormatInt(lc.now().UnixMilli(), 10)
+}
+
+func (lc *IopClient) now() time.Time {
+	if lc.clock != nil {
+		return lc.clock()
+	}
+	return time.Now()
+}
+
 // Debug setter
 func (lc *IopClient) Debug(enableDebug bool) *IopClient {
 	if enableDebug {
@@ -87,12 +231,21 @@ func (lc *IopClient) Debug(enableDebug bool) *IopClient {
 
 // Generate auth url
 func (me *IopClient) MakeAuthURL() string {
+	return me.MakeAuthURLWithState("")
+}
+
+// MakeAuthURLWithState generates the auth url carrying an opaque state that
+// Lazada echoes back to the callback, used to protect against login CSRF
+func (me *IopClient) MakeAuthURLWithState(state string) string {
 	params := neturl.Values{}
 	params.Add("response_type", "code")
 	params.Add("force_auth", "true")
-	params.Add("country", me.Region)
+	params.Add("country", string(me.Region))
 	params.Add("redirect_uri", me.CallbackURL)
 	params.Add("client_id", me.APIKey)
+	if state != "" {
+		params.Add("state", state)
+	}
 	return AuthURL + `?` + params.Encode()
 }
 
@@ -108,48 +261,43 @@ func (lc *IopClient) SetAccessToken(accessToken string) *IopClient {
 }
 
 // ChangeRegion setter
-func (lc *IopClient) ChangeRegion(region string) *IopClient {
+func (lc *IopClient) ChangeRegion(region Region) *IopClient {
 	lc.Region = region
 	return lc
 }
 
 // AddAPIParam setter
 func (lc *IopClient) AddAPIParam(key string, val string) *IopClient {
+	if lc.APIParams == nil {
+		lc.APIParams = map[string]string{}
+	}
 	lc.APIParams[key] = val
 	return lc
 }
 
-// AddFileParam setter
-func (lc *IopClient) AddFileParam(key string, val []byte) *IopClient {
-	lc.FileParams[key] = val
+// AddFile setter, for uploads needing a specific field name, content type
+// or streaming
+func (lc *IopClient) AddFile(file FileParam) *IopClient {
+	lc.Files = append(lc.Files, file)
 	return lc
 }
 
-// Create sign from system params and api params
-func (lc *IopClient) sign(url string) string {
-	keys := []string{}
-	union := map[string]string{}
-	for key, val := range lc.SysParams {
-		union[key] = val
-		keys = append(keys, key)
-	}
-	for key, val := range lc.APIParams {
-		union[key] = val
-		keys = append(keys, key)
+// AddFileParam setter, the file is sent in the "image" field named key
+func (lc *IopClient) AddFileParam(key string, val []byte) *IopClient {
+	if lc.FileParams == nil {
+		lc.FileParams = map[string][]byte{}
 	}
+	lc.FileParams[key] = val
+	return lc
+}
 
-	// sort sys params and api params by key
-	sort.Strings(keys)
-
-	var message bytes.Buffer
-	message.WriteString(fmt.Sprintf("%s", url))
-	for _, key := range keys {
-		message.WriteString(fmt.Sprintf("%s%s", key, union[key]))
+// Create sign from the full set of signed params
+func (lc *IopClient) sign(url string, params map[string]string) string {
+	signer := lc.signer
+	if signer == nil {
+		signer = SignerSHA256
 	}
-
-	hash := hmac.New(sha256.New, []byte(lc.APISecret))
-	hash.Write(message.Bytes())
-	return strings.ToUpper(hex.EncodeToString(hash.Sum(nil)))
+	return signer.Sign(url, params, lc.APISecret)
 }
 
 // Response success
@@ -159,112 +307,264 @@ type Response struct {
 	Message   string          `json:"message"`
 	RequestID string          `json:"request_id"`
 	Data      json.RawMessage `json:"data"`
-}
 
-// ResponseError defines a error response
-type ResponseError struct {
-	Code      string `json:"code"`
-	Type      string `json:"type"`
-	Message   string `json:"message"`
-	RequestID string `json:"request_id"`
+	// Body is the raw response, some APIs like /auth/token/create return
+	// their payload at the top level rather than under data
+	Body json.RawMessage `json:"-"`
 }
 
 func (lc *IopClient) getServerURL() string {
-	switch lc.Region {
-	case "SG":
-		return APIGatewaySG
-	case "MY":
-		return APIGatewayMY
-	case "VN":
-		return APIGatewayVN
-	case "TH":
-		return APIGatewayTH
-	case "PH":
-		return APIGatewayPH
-	case "ID":
-		return APIGatewayID
-	}
-	return ""
+	return lc.Region.Gateway()
+}
+
+// serverURL resolves the gateway for apiPath. BaseURL wins over everything,
+// then /auth/* APIs are only served by the auth gateway while everything
+// else needs a known region.
+func (lc *IopClient) serverURL(apiPath string) (string, error) {
+	if lc.BaseURL != "" {
+		return strings.TrimSuffix(lc.BaseURL, "/"), nil
+	}
+	if strings.HasPrefix(apiPath, "/auth/") {
+		return APIGatewayAuth, nil
+	}
+	if serverURL := lc.getServerURL(); serverURL != "" {
+		return serverURL, nil
+	}
+	if lc.Region == "" {
+		return "", &ConfigError{Message: fmt.Sprintf("no region or BaseURL set, calling %s", apiPath)}
+	}
+	return "", errUnknownRegion(string(lc.Region))
 }
 
 // Execute sends the request though http.request and collect the response
 func (lc *IopClient) Execute(apiPath string, apiMethod string, bodyParams map[string]string) (*Response, error) {
-	var req *http.Request
-	var err error
-	var contentType string
+	return lc.ExecuteContext(context.Background(), apiPath, apiMethod, bodyParams)
+}
 
-	// add query params
-	values := url.Values{}
-	for key, val := range lc.SysParams {
-		values.Add(key, val)
+// ExecuteContext is like Execute but binds the http request to ctx, so a
+// cancelled or expired context aborts the call in flight.
+//
+// For POST the params added with AddAPIParam and bodyParams are sent
+// together, see call for where they end up. bodyParams are ignored for
+// other methods.
+//
+// Execute and ExecuteContext consume the params added with AddAPIParam and
+// AddFileParam and are not safe for concurrent use, use NewRequest instead
+// when the client is shared between goroutines.
+func (lc *IopClient) ExecuteContext(ctx context.Context, apiPath string, apiMethod string, bodyParams map[string]string) (*Response, error) {
+	c := &call{
+		path:      apiPath,
+		method:    apiMethod,
+		sysParams: copyParams(lc.SysParams),
+		params:    copyParams(lc.APIParams),
+		files:     lc.Files,
+		inQuery:   lc.postParamsInQuery,
+	}
+	for key, val := range lc.FileParams {
+		c.files = append(c.files, FileParam{FileName: key, Data: val})
 	}
-
-	// POST handle
-	body := &bytes.Buffer{}
 	if apiMethod == http.MethodPost {
-		writer := multipart.NewWriter(body)
-		contentType = writer.FormDataContentType()
-		if len(lc.FileParams) > 0 {
-			// add formfile to handle file upload
-			for key, val := range lc.FileParams {
-				part, err := writer.CreateFormFile("image", key)
-				if err != nil {
-					return nil, err
-				}
-				_, err = part.Write(val)
-				if err != nil {
-					return nil, err
-				}
-			}
+		for key, val := range bodyParams {
+			c.params[key] = val
 		}
+	}
 
-		if len(bodyParams) != 0 {
-			for k, v := range bodyParams {
-				lc.AddAPIParam(k, v)
-				_ = writer.WriteField(k, v)
-			}
+	lc.APIParams = map[string]string{}
+	lc.FileParams = map[string][]byte{}
+	lc.Files = nil
+
+	return lc.execute(ctx, c)
+}
+
+// call is a self-contained snapshot of everything needed to send a request,
+// so that sending never touches the client's mutable state.
+//
+// System params always go in the query string. API params go in the query
+// string for GET or when inQuery is set, otherwise in the body, which is
+// multipart when there are files and form-urlencoded otherwise. Each param
+// is signed exactly once, wherever it is sent.
+type call struct {
+	path      string
+	method    string
+	sysParams map[string]string
+	params    map[string]string
+	files     []FileParam
+	inQuery   bool
+	// retrySafe marks a non-idempotent call as safe to send again
+	retrySafe bool
+}
+
+func (c *call) paramsInQuery() bool {
+	return c.method != http.MethodPost || c.inQuery
+}
+
+// idempotent reports whether the call may be sent again after a failure
+// that the gateway might already have processed
+func (c *call) idempotent() bool {
+	switch c.method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return c.retrySafe
+}
+
+// execute encodes the body once and sends it, retrying if a policy is set
+func (lc *IopClient) execute(ctx context.Context, c *call) (*Response, error) {
+	var body *requestBody
+	var err error
+	bodyParams := c.params
+	if c.paramsInQuery() {
+		bodyParams = nil
+	}
+	switch {
+	case len(c.files) > 0:
+		body, err = newMultipartBody(c.files, bodyParams)
+	case c.method == http.MethodPost:
+		body = newFormBody(bodyParams)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	serverURL, err := lc.serverURL(c.path)
+	if err != nil {
+		return nil, err
+	}
 
+	policy := lc.retryPolicy
+	if body != nil && body.stream != nil {
+		policy = nil
+	}
+	for attempt := 1; ; attempt++ {
+		resp, statusCode, retryAfter, err := lc.do(ctx, serverURL, c, body)
+		if policy == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil ||
+			!policy.retryable(c, statusCode, resp, err) {
+			return resp, err
 		}
 
-		if err = writer.Close(); err != nil {
-			return nil, err
+		delay := policy.backoff(attempt, retryAfter)
+		lc.log(LevelWarn, "retrying request",
+			Field{"path", c.path},
+			Field{"attempt", attempt + 1},
+			Field{"max_attempts", policy.MaxAttempts},
+			Field{"delay", delay},
+			Field{"error", err},
+		)
+		if err := sleepContext(ctx, delay); err != nil {
+			return resp, err
 		}
 	}
+}
+
+// do signs and sends a single attempt, the timestamp is refreshed so that
+// every retry carries a valid signature
+func (lc *IopClient) do(ctx context.Context, serverURL string, c *call, body *requestBody) (*Response, int, time.Duration, error) {
+	sysParams := copyParams(c.sysParams)
+	sysParams["timestamp"] = lc.timestamp()
+
+	signed := copyParams(sysParams)
+	for key, val := range c.params {
+		signed[key] = val
+	}
 
-	// GET handle
-	if apiMethod == http.MethodGet {
-		for key, val := range lc.APIParams {
+	// add query params
+	values := url.Values{}
+	for key, val := range sysParams {
+		values.Add(key, val)
+	}
+	var bodyParams map[string]string
+	if c.paramsInQuery() {
+		for key, val := range c.params {
 			values.Add(key, val)
 		}
+	} else {
+		bodyParams = c.params
 	}
 
-	apiServerURL := lc.getServerURL()
-
-	values.Add("sign", lc.sign(apiPath))
-	fullURL := fmt.Sprintf("%s%s?%s", apiServerURL, apiPath, values.Encode())
-	req, err = http.NewRequest(apiMethod, fullURL, body)
-
+	values.Add("sign", lc.sign(c.path, signed))
+	fullURL := fmt.Sprintf("%s%s?%s", serverURL, c.path, values.Encode())
+	redactedURL := fmt.Sprintf("%s%s?%s", serverURL, c.path, RedactValues(values).Encode())
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = body.reader()
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, fullURL, reqBody)
 	if err != nil {
-		return nil, err
+		// A streamed body is already being written by its pipe goroutine,
+		// closing the reader makes that goroutine stop
+		if closer, ok := reqBody.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, 0, 0, redactURLError(err, redactedURL)
 	}
-	if contentType != "" {
-		req.Header.Add("Content-Type", contentType)
+	if body != nil {
+		req.Header.Add("Content-Type", body.contentType)
 	}
-	log.Println(req)
-	httpResp, err := http.DefaultClient.Do(req)
+	lc.log(LevelDebug, "sending request",
+		Field{"method", c.method},
+		Field{"path", c.path},
+		Field{"query", RedactValues(values).Encode()},
+		Field{"body", RedactParams(bodyParams)},
+	)
+	httpClient := lc.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	start := time.Now()
+	httpResp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		err = redactURLError(err, redactedURL)
+		lc.log(LevelError, "request failed",
+			Field{"method", c.method},
+			Field{"path", c.path},
+			Field{"duration", time.Since(start)},
+			Field{"error", err},
+		)
+		return nil, 0, 0, err
 	}
 	defer httpResp.Body.Close()
+	retryAfter := parseRetryAfter(httpResp.Header.Get("Retry-After"))
 	respBody, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		return nil, err
+		return nil, httpResp.StatusCode, retryAfter, err
+	}
+	resp := &Response{Body: respBody}
+	if err = json.Unmarshal(respBody, resp); err != nil {
+		if httpResp.StatusCode >= http.StatusBadRequest {
+			return resp, httpResp.StatusCode, retryAfter, &ResponseError{
+				Message:    http.StatusText(httpResp.StatusCode),
+				StatusCode: httpResp.StatusCode,
+			}
+		}
+		return resp, httpResp.StatusCode, retryAfter, err
 	}
-	resp := &Response{}
-	err = json.Unmarshal(respBody, resp)
 
-	lc.APIParams = nil
-	lc.FileParams = nil
+	lc.log(LevelInfo, "request completed",
+		Field{"method", c.method},
+		Field{"path", c.path},
+		Field{"status", httpResp.StatusCode},
+		Field{"code", resp.Code},
+		Field{"request_id", resp.RequestID},
+		Field{"duration", time.Since(start)},
+	)
+
+	return resp, httpResp.StatusCode, retryAfter, resp.err(httpResp.StatusCode)
+}
 
-	return resp, err
+// redactURLError masks the signed URL carried by transport errors, they
+// are logged and returned to callers that may show them to anyone
+func redactURLError(err error, redactedURL string) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactedURL
+	}
+	return err
+}
+
+func copyParams(params map[string]string) map[string]string {
+	dup := make(map[string]string, len(params))
+	for key, val := range params {
+		dup[key] = val
+	}
+	return dup
 }
@@ -0,0 +1,334 @@
+package iop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is a fake http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// capturedRequest is what the fake gateway received
+type capturedRequest struct {
+	method      string
+	path        string
+	query       url.Values
+	contentType string
+	body        []byte
+}
+
+// newTestClient returns a client with a fixed clock talking to a fake
+// gateway that answers every call with respond. The captured requests must
+// only be read once the calls returned.
+func newTestClient(t *testing.T, respond func(req *capturedRequest) *http.Response) (*IopClient, *[]capturedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var captured []capturedRequest
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		c := capturedRequest{
+			method:      req.Method,
+			path:        req.URL.Path,
+			query:       req.URL.Query(),
+			contentType: req.Header.Get("Content-Type"),
+		}
+		if req.Body != nil {
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			c.body = body
+		}
+		mu.Lock()
+		captured = append(captured, c)
+		mu.Unlock()
+		return respond(&c), nil
+	})
+
+	client := NewClient(&ClientOptions{
+		APIKey:    "123456",
+		APISecret: "helloworld",
+		Region:    RegionMY,
+		Transport: transport,
+		Clock:     func() time.Time { return time.UnixMilli(1700000000000) },
+	})
+	client.SetAccessToken("test-token")
+	return client, &captured
+}
+
+func okResponse(*capturedRequest) *http.Response {
+	return newResponse(http.StatusOK, `{"code":"0","data":{},"request_id":"r1"}`)
+}
+
+const testPayload = "<Request><Product><Skus><Sku><SellerSku>sku-1</SellerSku><Quantity>5</Quantity></Sku></Skus></Product></Request>"
+
+// The GET, POST and multipart signatures below were computed for these
+// tests by applying the signing spec to the captured requests, they are
+// not examples published by Lazada.
+
+func TestGETSigning(t *testing.T) {
+	client, captured := newTestClient(t, okResponse)
+
+	_, err := client.NewRequest("/orders/get").
+		Param("created_after", "2024-01-01T00:00:00+08:00").
+		Param("status", "pending").
+		Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*captured)[0]
+	if req.method != http.MethodGet || req.path != "/rest/orders/get" {
+		t.Errorf("sent %s %s", req.method, req.path)
+	}
+	for key, want := range map[string]string{
+		"app_key":       "123456",
+		"sign_method":   "sha256",
+		"timestamp":     "1700000000000",
+		"access_token":  "test-token",
+		"created_after": "2024-01-01T00:00:00+08:00",
+		"status":        "pending",
+		"sign":          "91E586B7D1ECAA17C0038ED8E445224BE6E9FD73B0374C8EFF598C87DAE1A060",
+	} {
+		if got := req.query.Get(key); got != want {
+			t.Errorf("query %s = %q, want %q", key, got, want)
+		}
+	}
+	if len(req.body) != 0 {
+		t.Errorf("GET sent a body: %q", req.body)
+	}
+}
+
+func TestPOSTFormSigning(t *testing.T) {
+	client, captured := newTestClient(t, okResponse)
+
+	_, err := client.NewRequest("/product/price_quantity/update").
+		Method(http.MethodPost).
+		Param("payload", testPayload).
+		Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*captured)[0]
+	if req.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", req.contentType)
+	}
+	form, err := url.ParseQuery(string(req.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("payload") != testPayload {
+		t.Errorf("body payload = %q", form.Get("payload"))
+	}
+	if req.query.Has("payload") {
+		t.Error("payload sent in the query too")
+	}
+	if got, want := req.query.Get("sign"), "1D68154CA656ECCDFE74E7388A9B64CC2E037F00B38AF59F6BB2AC24568E1F40"; got != want {
+		t.Errorf("sign = %s, want %s", got, want)
+	}
+}
+
+func TestPostParamsInQuerySigning(t *testing.T) {
+	client, captured := newTestClient(t, okResponse)
+	client.postParamsInQuery = true
+
+	_, err := client.NewRequest("/product/price_quantity/update").
+		Method(http.MethodPost).
+		Param("payload", testPayload).
+		Do(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same params, same signature, wherever they are sent
+	req := (*captured)[0]
+	if req.query.Get("payload") != testPayload {
+		t.Errorf("query payload = %q", req.query.Get("payload"))
+	}
+	if form, _ := url.ParseQuery(string(req.body)); form.Has("payload") {
+		t.Error("payload sent in the body too")
+	}
+	if got, want := req.query.Get("sign"), "1D68154CA656ECCDFE74E7388A9B64CC2E037F00B38AF59F6BB2AC24568E1F40"; got != want {
+		t.Errorf("sign = %s, want %s", got, want)
+	}
+}
+
+func TestMultipartSigning(t *testing.T) {
+	for _, streamed := range []bool{false, true} {
+		client, captured := newTestClient(t, okResponse)
+
+		file := FileParam{FileName: "front.jpg", ContentType: "image/jpeg"}
+		if streamed {
+			file.Reader = bytes.NewReader([]byte("jpeg bytes"))
+		} else {
+			file.Data = []byte("jpeg bytes")
+		}
+		_, err := client.NewRequest("/image/upload").
+			Param("name", "front").
+			Upload(file).
+			Do(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Files are never signed, the other body params are
+		req := (*captured)[0]
+		if req.method != http.MethodPost {
+			t.Errorf("method = %s", req.method)
+		}
+		if got, want := req.query.Get("sign"), "77090FD42F4392D66D9E4E1667157F5FD0D37FBA1511ACCBA3E2EAE2201BA6E7"; got != want {
+			t.Errorf("streamed=%v: sign = %s, want %s", streamed, got, want)
+		}
+
+		mediaType, params, err := mime.ParseMediaType(req.contentType)
+		if err != nil || mediaType != "multipart/form-data" {
+			t.Fatalf("Content-Type = %q", req.contentType)
+		}
+		form, err := multipart.NewReader(bytes.NewReader(req.body), params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := form.Value["name"]; len(got) != 1 || got[0] != "front" {
+			t.Errorf("name field = %q", got)
+		}
+		files := form.File[DefaultFileField]
+		if len(files) != 1 || files[0].Filename != "front.jpg" {
+			t.Fatalf("image part = %+v", files)
+		}
+	}
+}
+
+func TestLegacyExecuteSigning(t *testing.T) {
+	client, captured := newTestClient(t, okResponse)
+
+	client.AddAPIParam("created_after", "2024-01-01T00:00:00+08:00")
+	client.AddAPIParam("status", "pending")
+	if _, err := client.Execute("/orders/get", http.MethodGet, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (*captured)[0].query.Get("sign"), "91E586B7D1ECAA17C0038ED8E445224BE6E9FD73B0374C8EFF598C87DAE1A060"; got != want {
+		t.Errorf("sign = %s, want %s", got, want)
+	}
+
+	// The params are reset after each call
+	if _, err := client.Execute("/orders/get", http.MethodGet, nil); err != nil {
+		t.Fatal(err)
+	}
+	if (*captured)[1].query.Has("status") {
+		t.Error("params leaked into the next call")
+	}
+}
+
+func TestResponseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		check  func(error) bool
+	}{
+		{"invalid token", http.StatusOK, `{"code":"IllegalAccessToken","message":"bad token","request_id":"r1"}`, IsInvalidToken},
+		{"rate limited code", http.StatusOK, `{"code":"ApiCallLimit","message":"slow down","request_id":"r1"}`, IsRateLimited},
+		{"rate limited status", http.StatusTooManyRequests, `Too Many Requests`, IsRateLimited},
+		{"invalid signature", http.StatusOK, `{"code":"IncompleteSignature","message":"bad sign","request_id":"r1"}`, IsInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, func(*capturedRequest) *http.Response {
+				return newResponse(tt.status, tt.body)
+			})
+			_, err := client.NewRequest("/orders/get").Do(context.Background())
+			var respErr *ResponseError
+			if !errors.As(err, &respErr) {
+				t.Fatalf("err = %v, want *ResponseError", err)
+			}
+			if respErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", respErr.StatusCode, tt.status)
+			}
+			if !tt.check(err) {
+				t.Errorf("%v not classified", err)
+			}
+		})
+	}
+
+	client, _ := newTestClient(t, okResponse)
+	if _, err := client.NewRequest("/orders/get").Do(context.Background()); err != nil {
+		t.Errorf("success returned %v", err)
+	}
+}
+
+func TestRetryOnlyIdempotent(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(*IopClient) *Request
+		status   int
+		attempts int
+	}{
+		{"GET after 5xx", func(c *IopClient) *Request { return c.NewRequest("/orders/get") }, http.StatusBadGateway, 3},
+		{"POST after 5xx", func(c *IopClient) *Request {
+			return c.NewRequest("/product/create").Method(http.MethodPost)
+		}, http.StatusBadGateway, 1},
+		{"POST after throttling", func(c *IopClient) *Request {
+			return c.NewRequest("/product/create").Method(http.MethodPost)
+		}, http.StatusTooManyRequests, 3},
+		{"idempotent POST after 5xx", func(c *IopClient) *Request {
+			return c.NewRequest("/products/get").Method(http.MethodPost).Idempotent()
+		}, http.StatusBadGateway, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, captured := newTestClient(t, func(*capturedRequest) *http.Response {
+				return newResponse(tt.status, "unavailable")
+			})
+			client.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+			if _, err := tt.build(client).Do(context.Background()); err == nil {
+				t.Fatal("expected an error")
+			}
+			if len(*captured) != tt.attempts {
+				t.Errorf("attempts = %d, want %d", len(*captured), tt.attempts)
+			}
+		})
+	}
+}
+
+func TestTransportErrorRedacted(t *testing.T) {
+	var logs bytes.Buffer
+	client, _ := newTestClient(t, nil)
+	client.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})})
+	client.SetLogger(NewStdLogger(log.New(&logs, "", 0), LevelDebug))
+
+	_, err := client.NewRequest("/orders/get").Do(context.Background())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, out := range []string{err.Error(), logs.String()} {
+		if strings.Contains(out, "test-token") || !strings.Contains(out, "REDACTED") {
+			t.Errorf("secrets not redacted: %s", out)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package jsonfile persists values as JSON files that several processes
+// can share, e.g. the token store written by the onboarding server and
+// read by the sync service.
+package jsonfile
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Read decodes the file at path into v, a missing or empty file leaves v
+// untouched. Writes are atomic so Read never needs the lock.
+func Read(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Write encodes v to path atomically, so a crash never leaves a truncated
+// file behind. Concurrent writers must hold the lock, see Update.
+func Write(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update reads path into v, calls fn to change it and writes v back, all
+// under an exclusive lock shared with every other process. Nothing is
+// written if fn fails.
+func Update(path string, v interface{}, fn func() error) error {
+	unlock, err := lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := Read(path, v); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return Write(path, v)
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package jsonfile
+
+import "sync"
+
+var mu sync.Mutex
+
+// lock only serializes writers within this process, there is no portable
+// file lock on this platform
+func lock(string) (func(), error) {
+	mu.Lock()
+	return mu.Unlock, nil
+}
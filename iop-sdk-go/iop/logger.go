@@ -0,0 +1,122 @@
+package iop
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// LogLevel is the severity of a log entry
+type LogLevel int
+
+// Log levels, from the most to the least verbose
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Field is a key/value pair attached to a log entry
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the SDK's structured log entries. Secrets are redacted
+// before they reach the logger. Logging is off unless a Logger is set.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// RedactedParams lists the params whose values never reach a Logger
+var RedactedParams = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"sign":          true,
+	"code":          true,
+}
+
+const redacted = "[REDACTED]"
+
+// RedactValues returns a copy of values with secret params masked
+func RedactValues(values url.Values) url.Values {
+	dup := make(url.Values, len(values))
+	for key, vals := range values {
+		if RedactedParams[key] {
+			dup[key] = []string{redacted}
+			continue
+		}
+		dup[key] = append([]string(nil), vals...)
+	}
+	return dup
+}
+
+// RedactParams returns a copy of params with secret params masked
+func RedactParams(params map[string]string) map[string]string {
+	dup := make(map[string]string, len(params))
+	for key, val := range params {
+		if RedactedParams[key] {
+			val = redacted
+		}
+		dup[key] = val
+	}
+	return dup
+}
+
+// StdLogger writes entries at or above MinLevel to a standard library logger
+type StdLogger struct {
+	Logger   *log.Logger
+	MinLevel LogLevel
+}
+
+// NewStdLogger returns a Logger on top of the standard log package, a nil
+// l writes to the default logger
+func NewStdLogger(l *log.Logger, minLevel LogLevel) *StdLogger {
+	return &StdLogger{Logger: l, MinLevel: minLevel}
+}
+
+// Log implements Logger
+func (s *StdLogger) Log(level LogLevel, msg string, fields ...Field) {
+	if level < s.MinLevel {
+		return
+	}
+
+	var line strings.Builder
+	line.WriteString(level.String())
+	line.WriteString(" iop: ")
+	line.WriteString(msg)
+	sorted := append([]Field(nil), fields...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	for _, f := range sorted {
+		fmt.Fprintf(&line, " %s=%v", f.Key, f.Value)
+	}
+
+	if s.Logger == nil {
+		log.Print(line.String())
+		return
+	}
+	s.Logger.Print(line.String())
+}
+
+func (lc *IopClient) log(level LogLevel, msg string, fields ...Field) {
+	if lc.logger != nil {
+		lc.logger.Log(level, msg, fields...)
+	}
+}
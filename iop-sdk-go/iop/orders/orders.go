@@ -0,0 +1,260 @@
+// Package orders is a typed client for the Lazada Orders APIs
+package orders
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"lazada/iop-sdk-go/iop"
+)
+
+// MaxLimit is the largest page size accepted by /orders/get
+const MaxLimit = 100
+
+// MaxOrderIDs is the largest batch accepted by /orders/items/get
+const MaxOrderIDs = 50
+
+// Status filters orders by status
+type Status string
+
+// Order statuses
+const (
+	StatusAll         Status = "all"
+	StatusUnpaid      Status = "unpaid"
+	StatusPending     Status = "pending"
+	StatusCanceled    Status = "canceled"
+	StatusReadyToShip Status = "ready_to_ship"
+	StatusShipped     Status = "shipped"
+	StatusDelivered   Status = "delivered"
+	StatusReturned    Status = "returned"
+	StatusFailed      Status = "failed"
+	StatusTopack      Status = "topack"
+	StatusToship      Status = "toship"
+	StatusShipping    Status = "shipping"
+	StatusLost        Status = "lost"
+)
+
+// SortBy is the field orders are sorted on
+type SortBy string
+
+// Sort fields
+const (
+	SortByCreatedAt SortBy = "created_at"
+	SortByUpdatedAt SortBy = "updated_at"
+)
+
+// SortDirection is the sort order
+type SortDirection string
+
+// Sort directions
+const (
+	SortAsc  SortDirection = "ASC"
+	SortDesc SortDirection = "DESC"
+)
+
+// GetOrdersRequest filters /orders/get, zero fields are left out. Either
+// CreatedAfter or UpdateAfter is required by Lazada.
+type GetOrdersRequest struct {
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdateAfter   time.Time
+	UpdateBefore  time.Time
+	Status        Status
+	SortBy        SortBy
+	SortDirection SortDirection
+	Offset        int
+	Limit         int
+}
+
+// Params returns the API params of r, offset and limit included only when
+// set so that r can also be handed to iop.Paginate
+func (r GetOrdersRequest) Params() map[string]string {
+	params := map[string]string{}
+	iop.SetTimeParam(params, "created_after", r.CreatedAfter)
+	iop.SetTimeParam(params, "created_before", r.CreatedBefore)
+	iop.SetTimeParam(params, "update_after", r.UpdateAfter)
+	iop.SetTimeParam(params, "update_before", r.UpdateBefore)
+	if r.Status != "" {
+		params["status"] = string(r.Status)
+	}
+	if r.SortBy != "" {
+		params["sort_by"] = string(r.SortBy)
+	}
+	if r.SortDirection != "" {
+		params["sort_direction"] = string(r.SortDirection)
+	}
+	if r.Offset > 0 {
+		params["offset"] = strconv.Itoa(r.Offset)
+	}
+	if r.Limit > 0 {
+		params["limit"] = strconv.Itoa(r.Limit)
+	}
+	return params
+}
+
+// Address is a billing or shipping address
+type Address struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Phone     string `json:"phone"`
+	Phone2    string `json:"phone2"`
+	Address1  string `json:"address1"`
+	Address2  string `json:"address2"`
+	Address3  string `json:"address3"`
+	Address4  string `json:"address4"`
+	Address5  string `json:"address5"`
+	City      string `json:"city"`
+	PostCode  string `json:"post_code"`
+	Country   string `json:"country"`
+}
+
+// Order is an order header as returned by /orders/get and /order/get
+type Order struct {
+	OrderID                     iop.Int    `json:"order_id"`
+	OrderNumber                 iop.Int    `json:"order_number"`
+	CreatedAt                   iop.Time   `json:"created_at"`
+	UpdatedAt                   iop.Time   `json:"updated_at"`
+	Statuses                    []string   `json:"statuses"`
+	ItemsCount                  int        `json:"items_count"`
+	Price                       iop.Number `json:"price"`
+	PaymentMethod               string     `json:"payment_method"`
+	Voucher                     iop.Number `json:"voucher"`
+	VoucherCode                 string     `json:"voucher_code"`
+	VoucherPlatform             iop.Number `json:"voucher_platform"`
+	VoucherSeller               iop.Number `json:"voucher_seller"`
+	ShippingFee                 iop.Number `json:"shipping_fee"`
+	ShippingFeeOriginal         iop.Number `json:"shipping_fee_original"`
+	ShippingFeeDiscountPlatform iop.Number `json:"shipping_fee_discount_platform"`
+	ShippingFeeDiscountSeller   iop.Number `json:"shipping_fee_discount_seller"`
+	WarehouseCode               string     `json:"warehouse_code"`
+	CustomerFirstName           string     `json:"customer_first_name"`
+	CustomerLastName            string     `json:"customer_last_name"`
+	Remarks                     string     `json:"remarks"`
+	DeliveryInfo                string     `json:"delivery_info"`
+	GiftMessage                 string     `json:"gift_message"`
+	PromisedShippingTimes       string     `json:"promised_shipping_times"`
+	ExtraAttributes             string     `json:"extra_attributes"`
+	AddressBilling              Address    `json:"address_billing"`
+	AddressShipping             Address    `json:"address_shipping"`
+}
+
+// OrderItem is a line of an order
+type OrderItem struct {
+	OrderItemID          iop.Int    `json:"order_item_id"`
+	OrderID              iop.Int    `json:"order_id"`
+	ShopID               string     `json:"shop_id"`
+	SkuID                iop.Int    `json:"sku_id"`
+	Sku                  string     `json:"sku"`
+	ShopSku              string     `json:"shop_sku"`
+	Name                 string     `json:"name"`
+	Variation            string     `json:"variation"`
+	Status               string     `json:"status"`
+	Currency             string     `json:"currency"`
+	ItemPrice            iop.Number `json:"item_price"`
+	PaidPrice            iop.Number `json:"paid_price"`
+	TaxAmount            iop.Number `json:"tax_amount"`
+	ShippingAmount       iop.Number `json:"shipping_amount"`
+	ShippingFeeOriginal  iop.Number `json:"shipping_fee_original"`
+	VoucherSeller        iop.Number `json:"voucher_seller"`
+	VoucherPlatform      iop.Number `json:"voucher_platform"`
+	VoucherCode          string     `json:"voucher_code"`
+	TrackingCode         string     `json:"tracking_code"`
+	TrackingCodePre      string     `json:"tracking_code_pre"`
+	ShipmentProvider     string     `json:"shipment_provider"`
+	ShippingType         string     `json:"shipping_type"`
+	PackageID            string     `json:"package_id"`
+	WarehouseCode        string     `json:"warehouse_code"`
+	PromisedShippingTime string     `json:"promised_shipping_time"`
+	Reason               string     `json:"reason"`
+	ReasonDetail         string     `json:"reason_detail"`
+	ReturnStatus         string     `json:"return_status"`
+	ProductMainImage     string     `json:"product_main_image"`
+	ProductDetailURL     string     `json:"product_detail_url"`
+	InvoiceNumber        string     `json:"invoice_number"`
+	CreatedAt            iop.Time   `json:"created_at"`
+	UpdatedAt            iop.Time   `json:"updated_at"`
+}
+
+// OrderItems groups the items of one order, as returned by
+// /orders/items/get
+type OrderItems struct {
+	OrderID     iop.Int     `json:"order_id"`
+	OrderNumber iop.Int     `json:"order_number"`
+	OrderItems  []OrderItem `json:"order_items"`
+}
+
+// OrdersPage is one page of /orders/get
+type OrdersPage struct {
+	Count      int     `json:"count"`
+	CountTotal int     `json:"countTotal"`
+	Orders     []Order `json:"orders"`
+}
+
+// Client calls the Orders APIs with the access token of the wrapped client
+type Client struct {
+	client *iop.IopClient
+}
+
+// New wraps client
+func New(client *iop.IopClient) *Client {
+	return &Client{client: client}
+}
+
+// GetOrders calls /orders/get
+func (c *Client) GetOrders(ctx context.Context, req GetOrdersRequest) (*OrdersPage, error) {
+	if req.Limit > MaxLimit {
+		return nil, fmt.Errorf("orders: limit %d exceeds %d", req.Limit, MaxLimit)
+	}
+
+	page := &OrdersPage{}
+	if err := c.client.NewRequest("/orders/get").Params(req.Params()).DoInto(ctx, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetOrder calls /order/get
+func (c *Client) GetOrder(ctx context.Context, orderID int64) (*Order, error) {
+	order := &Order{}
+	params := map[string]string{"order_id": strconv.FormatInt(orderID, 10)}
+	if err := c.client.NewRequest("/order/get").Params(params).DoInto(ctx, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrderItems calls /order/items/get
+func (c *Client) GetOrderItems(ctx context.Context, orderID int64) ([]OrderItem, error) {
+	var items []OrderItem
+	params := map[string]string{"order_id": strconv.FormatInt(orderID, 10)}
+	if err := c.client.NewRequest("/order/items/get").Params(params).DoInto(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetMultipleOrderItems calls /orders/items/get for up to MaxOrderIDs
+// orders at once
+func (c *Client) GetMultipleOrderItems(ctx context.Context, orderIDs []int64) ([]OrderItems, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+	if len(orderIDs) > MaxOrderIDs {
+		return nil, fmt.Errorf("orders: %d order IDs exceed %d", len(orderIDs), MaxOrderIDs)
+	}
+
+	ids := make([]string, len(orderIDs))
+	for i, id := range orderIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	var items []OrderItems
+	params := map[string]string{"order_ids": "[" + strings.Join(ids, ",") + "]"}
+	if err := c.client.NewRequest("/orders/items/get").Params(params).DoInto(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
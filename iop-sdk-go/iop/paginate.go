@@ -0,0 +1,188 @@
+package iop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PaginateOptions describes how an offset-based list API is paged
+type PaginateOptions struct {
+	// CountPath is the dotted path of the total count inside data, e.g.
+	// "countTotal" for /orders/get or "total_products" for /products/get
+	CountPath string
+	// PageSize is the limit of each page, capped at MaxPageSize
+	PageSize int
+	// MaxPageSize is the largest limit the endpoint accepts, 0 for no cap
+	MaxPageSize int
+	// Concurrency is the number of pages fetched in parallel, 1 by default
+	Concurrency int
+	// Ordered delivers pages by increasing offset, at the cost of waiting
+	// for a slow page before emitting the ones after it
+	Ordered bool
+
+	// OffsetParam and LimitParam default to "offset" and "limit"
+	OffsetParam string
+	LimitParam  string
+}
+
+// Page is one page of a list API, Err is set when it could not be fetched
+type Page struct {
+	Offset   int
+	Limit    int
+	Response *Response
+	Err      error
+}
+
+// Pagination is the result of Paginate. Pages is closed once every page
+// has been delivered or ctx is done.
+type Pagination struct {
+	Total int
+	Pages <-chan Page
+}
+
+// Paginate fetches the total count of apiPath with params, then fans out
+// one request per page. The consumer must drain Pages or cancel ctx.
+func Paginate(ctx context.Context, client *IopClient, apiPath string, params map[string]string, opts PaginateOptions) (*Pagination, error) {
+	offsetParam := opts.OffsetParam
+	if offsetParam == "" {
+		offsetParam = "offset"
+	}
+	limitParam := opts.LimitParam
+	if limitParam == "" {
+		limitParam = "limit"
+	}
+	pageSize := opts.PageSize
+	if opts.MaxPageSize > 0 && (pageSize <= 0 || pageSize > opts.MaxPageSize) {
+		pageSize = opts.MaxPageSize
+	}
+	if pageSize <= 0 {
+		return nil, &ConfigError{Message: "paginate: page size must be positive"}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	base := client.NewRequest(apiPath).Params(params)
+
+	resp, err := base.Param(offsetParam, "0").Param(limitParam, "1").Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total, err := lookupInt(resp.Data, opts.CountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	type task struct {
+		offset int
+		slot   chan Page
+	}
+	tasks := make(chan task)
+	// slots hands the per-page result slots to the emitter in offset order,
+	// its capacity bounds how far ahead of the emitter the workers can get
+	slots := make(chan chan Page, concurrency)
+	out := make(chan Page)
+
+	go func() {
+		defer close(tasks)
+		defer close(slots)
+		for offset := 0; offset < total; offset += pageSize {
+			t := task{offset: offset}
+			if opts.Ordered {
+				t.slot = make(chan Page, 1)
+				select {
+				case slots <- t.slot:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case tasks <- t:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				page := Page{Offset: t.offset, Limit: pageSize}
+				page.Response, page.Err = base.
+					Param(offsetParam, strconv.Itoa(t.offset)).
+					Param(limitParam, strconv.Itoa(pageSize)).
+					Do(ctx)
+
+				if t.slot != nil {
+					t.slot <- page
+					continue
+				}
+				select {
+				case out <- page:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if opts.Ordered {
+		go func() {
+			defer close(out)
+			for slot := range slots {
+				select {
+				case page := <-slot:
+					select {
+					case out <- page:
+					case <-ctx.Done():
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	} else {
+		go func() {
+			wg.Wait()
+			close(out)
+		}()
+	}
+
+	return &Pagination{Total: total, Pages: out}, nil
+}
+
+// lookupInt reads the number at a dotted path such as "data.total" in a
+// JSON document
+func lookupInt(data json.RawMessage, path string) (int, error) {
+	var node interface{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return 0, err
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("iop: count path %q not found", path)
+		}
+		if node, ok = obj[key]; !ok {
+			return 0, fmt.Errorf("iop: count path %q not found", path)
+		}
+	}
+
+	switch v := node.(type) {
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("iop: count path %q is not a number", path)
+}
@@ -0,0 +1,53 @@
+package iop
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPaginateOrdered(t *testing.T) {
+	client, _ := newTestClient(t, func(req *capturedRequest) *http.Response {
+		offset, _ := strconv.Atoi(req.query.Get("offset"))
+		if req.query.Get("limit") != "1" {
+			// Earlier pages answer last, the output must still be ordered
+			time.Sleep(time.Duration(50-offset) * time.Millisecond)
+		}
+		return newResponse(http.StatusOK, fmt.Sprintf(`{"code":"0","data":{"countTotal":"45","offset":%d}}`, offset))
+	})
+
+	pagination, err := Paginate(context.Background(), client, "/orders/get", map[string]string{"status": "pending"},
+		PaginateOptions{CountPath: "countTotal", PageSize: 10, Concurrency: 4, Ordered: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pagination.Total != 45 {
+		t.Errorf("Total = %d, want 45", pagination.Total)
+	}
+
+	want := 0
+	for page := range pagination.Pages {
+		if page.Err != nil {
+			t.Fatal(page.Err)
+		}
+		if page.Offset != want || page.Limit != 10 {
+			t.Errorf("got page %d/%d, want offset %d", page.Offset, page.Limit, want)
+		}
+		want += 10
+	}
+	if want != 50 {
+		t.Errorf("got %d pages, want 5", want/10)
+	}
+}
+
+func TestPaginateCountPathMissing(t *testing.T) {
+	client, _ := newTestClient(t, okResponse)
+	_, err := Paginate(context.Background(), client, "/orders/get", nil,
+		PaginateOptions{CountPath: "countTotal", PageSize: 10})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,274 @@
+// Package products is a typed client for the Lazada Products APIs
+package products
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"lazada/iop-sdk-go/iop"
+)
+
+// MaxLimit is the largest page size accepted by /products/get
+const MaxLimit = 50
+
+// Filter selects products by state in /products/get
+type Filter string
+
+// Product filters
+const (
+	FilterAll          Filter = "all"
+	FilterLive         Filter = "live"
+	FilterInactive     Filter = "inactive"
+	FilterDeleted      Filter = "deleted"
+	FilterImageMissing Filter = "image-missing"
+	FilterPending      Filter = "pending"
+	FilterRejected     Filter = "rejected"
+	FilterSoldOut      Filter = "sold-out"
+)
+
+// String implements fmt.Stringer
+func (f Filter) String() string {
+	return string(f)
+}
+
+// ParseFilter parses a filter name such as "sold-out"
+func ParseFilter(s string) (Filter, error) {
+	f := Filter(strings.ToLower(strings.TrimSpace(s)))
+	switch f {
+	case FilterAll, FilterLive, FilterInactive, FilterDeleted, FilterImageMissing,
+		FilterPending, FilterRejected, FilterSoldOut:
+		return f, nil
+	}
+	return "", fmt.Errorf("products: unknown filter %q", s)
+}
+
+// GetProductsRequest filters /products/get, zero fields are left out
+type GetProductsRequest struct {
+	Filter        Filter
+	Search        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdateAfter   time.Time
+	UpdateBefore  time.Time
+	SellerSkus    []string
+	Offset        int
+	Limit         int
+}
+
+// Params returns the API params of r, offset and limit included only when
+// set so that r can also be handed to iop.Paginate
+func (r GetProductsRequest) Params() map[string]string {
+	params := map[string]string{}
+	iop.SetTimeParam(params, "create_after", r.CreatedAfter)
+	iop.SetTimeParam(params, "create_before", r.CreatedBefore)
+	iop.SetTimeParam(params, "update_after", r.UpdateAfter)
+	iop.SetTimeParam(params, "update_before", r.UpdateBefore)
+	if r.Filter != "" {
+		params["filter"] = string(r.Filter)
+	}
+	if r.Search != "" {
+		params["search"] = r.Search
+	}
+	if len(r.SellerSkus) > 0 {
+		skus, _ := json.Marshal(r.SellerSkus)
+		params["sku_seller_list"] = string(skus)
+	}
+	if r.Offset > 0 {
+		params["offset"] = strconv.Itoa(r.Offset)
+	}
+	if r.Limit > 0 {
+		params["limit"] = strconv.Itoa(r.Limit)
+	}
+	return params
+}
+
+// Attributes are the product level attributes. Category specific
+// attributes that have no field are kept in Other.
+type Attributes struct {
+	Name             string `json:"name"`
+	ShortDescription string `json:"short_description"`
+	Description      string `json:"description"`
+	Brand            string `json:"brand"`
+	Model            string `json:"model"`
+	WarrantyType     string `json:"warranty_type"`
+	Warranty         string `json:"warranty"`
+
+	Other map[string]string `json:"-"`
+}
+
+var attributeFields = fieldNames(Attributes{})
+
+// UnmarshalJSON implements json.Unmarshaler
+func (a *Attributes) UnmarshalJSON(data []byte) error {
+	type plain Attributes
+	if err := json.Unmarshal(data, (*plain)(a)); err != nil {
+		return err
+	}
+	other, err := extraFields(data, attributeFields)
+	a.Other = other
+	return err
+}
+
+// SKU is a variant of a product
+type SKU struct {
+	SkuID          iop.Int    `json:"SkuId"`
+	SellerSku      string     `json:"SellerSku"`
+	ShopSku        string     `json:"ShopSku"`
+	Status         string     `json:"Status"`
+	URL            string     `json:"Url"`
+	Price          iop.Number `json:"price"`
+	SpecialPrice   iop.Number `json:"special_price"`
+	SpecialFrom    iop.Time   `json:"special_from_time"`
+	SpecialTo      iop.Time   `json:"special_to_time"`
+	Quantity       iop.Int    `json:"quantity"`
+	Available      iop.Int    `json:"Available"`
+	SellableStock  iop.Int    `json:"sellableStock"`
+	PackageWidth   iop.Number `json:"package_width"`
+	PackageHeight  iop.Number `json:"package_height"`
+	PackageLength  iop.Number `json:"package_length"`
+	PackageWeight  iop.Number `json:"package_weight"`
+	PackageContent string     `json:"package_content"`
+	Images         []string   `json:"Images"`
+
+	// Variation holds the variation attributes such as color_family or
+	// size, i.e. every scalar field that has no dedicated field above
+	Variation map[string]string `json:"-"`
+}
+
+var skuFields = fieldNames(SKU{})
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *SKU) UnmarshalJSON(data []byte) error {
+	type plain SKU
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	variation, err := extraFields(data, skuFields)
+	s.Variation = variation
+	return err
+}
+
+// Product is a product with all its SKUs
+type Product struct {
+	ItemID          iop.Int    `json:"item_id"`
+	PrimaryCategory iop.Int    `json:"primary_category"`
+	Status          string     `json:"status"`
+	SubStatus       string     `json:"subStatus"`
+	CreatedTime     iop.Time   `json:"created_time"`
+	UpdatedTime     iop.Time   `json:"updated_time"`
+	Images          []string   `json:"images"`
+	MarketImages    []string   `json:"marketImages"`
+	Attributes      Attributes `json:"attributes"`
+	Skus            []SKU      `json:"skus"`
+}
+
+// TotalQuantity returns the sum of the quantity of every SKU
+func (p *Product) TotalQuantity() int64 {
+	var total int64
+	for _, sku := range p.Skus {
+		total += int64(sku.Quantity)
+	}
+	return total
+}
+
+// SellerSkus returns the seller SKU of every variant
+func (p *Product) SellerSkus() []string {
+	skus := make([]string, len(p.Skus))
+	for i, sku := range p.Skus {
+		skus[i] = sku.SellerSku
+	}
+	return skus
+}
+
+// ProductsPage is one page of /products/get
+type ProductsPage struct {
+	TotalProducts int       `json:"total_products"`
+	Products      []Product `json:"products"`
+}
+
+// Client calls the Products APIs with the access token of the wrapped
+// client
+type Client struct {
+	client *iop.IopClient
+}
+
+// New wraps client
+func New(client *iop.IopClient) *Client {
+	return &Client{client: client}
+}
+
+// GetProducts calls /products/get, Filter selects live, inactive, deleted,
+// pending, rejected or sold-out products
+func (c *Client) GetProducts(ctx context.Context, req GetProductsRequest) (*ProductsPage, error) {
+	if req.Limit > MaxLimit {
+		return nil, fmt.Errorf("products: limit %d exceeds %d", req.Limit, MaxLimit)
+	}
+
+	page := &ProductsPage{}
+	if err := c.client.NewRequest("/products/get").Params(req.Params()).DoInto(ctx, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetProductItem calls /product/item/get by item ID
+func (c *Client) GetProductItem(ctx context.Context, itemID int64) (*Product, error) {
+	return c.getProductItem(ctx, map[string]string{"item_id": strconv.FormatInt(itemID, 10)})
+}
+
+// GetProductItemBySellerSku calls /product/item/get by seller SKU
+func (c *Client) GetProductItemBySellerSku(ctx context.Context, sellerSku string) (*Product, error) {
+	return c.getProductItem(ctx, map[string]string{"seller_sku": sellerSku})
+}
+
+func (c *Client) getProductItem(ctx context.Context, params map[string]string) (*Product, error) {
+	product := &Product{}
+	if err := c.client.NewRequest("/product/item/get").Params(params).DoInto(ctx, product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// extraFields returns the scalar fields of a JSON object that are not in
+// known, stringified
+func extraFields(data []byte, known map[string]bool) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	extra := map[string]string{}
+	for key, val := range raw {
+		if known[key] || len(val) == 0 || val[0] == '{' || val[0] == '[' {
+			continue
+		}
+		var s string
+		if val[0] == '"' {
+			if err := json.Unmarshal(val, &s); err != nil {
+				return nil, err
+			}
+		} else {
+			s = string(val)
+		}
+		if s != "" && s != "null" {
+			extra[key] = s
+		}
+	}
+	return extra, nil
+}
+
+// fieldNames returns the json names of the fields of struct v
+func fieldNames(v interface{}) map[string]bool {
+	names := map[string]bool{}
+	data, _ := json.Marshal(v)
+	var raw map[string]json.RawMessage
+	_ = json.Unmarshal(data, &raw)
+	for key := range raw {
+		names[key] = true
+	}
+	return names
+}
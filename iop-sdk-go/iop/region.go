@@ -0,0 +1,93 @@
+package iop
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Region is a Lazada country
+type Region string
+
+// Supported regions
+const (
+	RegionSG Region = "SG"
+	RegionMY Region = "MY"
+	RegionVN Region = "VN"
+	RegionTH Region = "TH"
+	RegionPH Region = "PH"
+	RegionID Region = "ID"
+)
+
+// RegionInfo describes a region
+type RegionInfo struct {
+	Region   Region
+	Name     string
+	Currency string
+	Timezone string
+	Gateway  string
+}
+
+var regions = map[Region]RegionInfo{
+	RegionSG: {RegionSG, "Singapore", "SGD", "Asia/Singapore", APIGatewaySG},
+	RegionMY: {RegionMY, "Malaysia", "MYR", "Asia/Kuala_Lumpur", APIGatewayMY},
+	RegionVN: {RegionVN, "Vietnam", "VND", "Asia/Ho_Chi_Minh", APIGatewayVN},
+	RegionTH: {RegionTH, "Thailand", "THB", "Asia/Bangkok", APIGatewayTH},
+	RegionPH: {RegionPH, "Philippines", "PHP", "Asia/Manila", APIGatewayPH},
+	RegionID: {RegionID, "Indonesia", "IDR", "Asia/Jakarta", APIGatewayID},
+}
+
+// Regions returns every supported region, sorted
+func Regions() []Region {
+	list := make([]Region, 0, len(regions))
+	for r := range regions {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// ParseRegion parses a country code such as "my" or "MY"
+func ParseRegion(s string) (Region, error) {
+	r := Region(strings.ToUpper(strings.TrimSpace(s)))
+	if !r.Valid() {
+		return "", errUnknownRegion(s)
+	}
+	return r, nil
+}
+
+func errUnknownRegion(s string) error {
+	return &ConfigError{Message: fmt.Sprintf("unknown region %q, expected one of %v", s, Regions())}
+}
+
+// Valid reports whether r is a supported region
+func (r Region) Valid() bool {
+	_, ok := regions[r]
+	return ok
+}
+
+// Info returns the metadata of r
+func (r Region) Info() (RegionInfo, bool) {
+	info, ok := regions[r]
+	return info, ok
+}
+
+// Gateway returns the API gateway of r, or "" for an unknown region
+func (r Region) Gateway() string {
+	return regions[r].Gateway
+}
+
+// Currency returns the ISO 4217 currency of r
+func (r Region) Currency() string {
+	return regions[r].Currency
+}
+
+// Location returns the time zone of r
+func (r Region) Location() (*time.Location, error) {
+	info, ok := regions[r]
+	if !ok {
+		return nil, errUnknownRegion(string(r))
+	}
+	return time.LoadLocation(info.Timezone)
+}
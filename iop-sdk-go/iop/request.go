@@ -0,0 +1,131 @@
+package iop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Request is a single API call built from a shared IopClient. Every builder
+// method returns a copy, so a partially built request can be reused as a
+// template without params leaking between calls.
+type Request struct {
+	client *IopClient
+	path   string
+	method string
+	params map[string]string
+	files  []FileParam
+	token  string
+	query  bool
+	safe   bool
+}
+
+// NewRequest starts a GET request for apiPath. Unlike Execute it never
+// touches the client's params, so one client can serve many goroutines as
+// long as its setters are not called concurrently.
+func (lc *IopClient) NewRequest(apiPath string) *Request {
+	return &Request{
+		client: lc,
+		path:   apiPath,
+		method: http.MethodGet,
+	}
+}
+
+func (r *Request) clone() *Request {
+	dup := *r
+	dup.params = copyParams(r.params)
+	dup.files = append([]FileParam(nil), r.files...)
+	return &dup
+}
+
+// Method sets the http method, GET by default
+func (r *Request) Method(method string) *Request {
+	dup := r.clone()
+	dup.method = method
+	return dup
+}
+
+// Param adds an API param, sent in the query for GET and the body for POST
+// unless ParamsInQuery is set
+func (r *Request) Param(key, val string) *Request {
+	dup := r.clone()
+	dup.params[key] = val
+	return dup
+}
+
+// Params adds every param of params
+func (r *Request) Params(params map[string]string) *Request {
+	dup := r.clone()
+	for key, val := range params {
+		dup.params[key] = val
+	}
+	return dup
+}
+
+// File adds a file to upload in the "image" field, the request is sent
+// as POST
+func (r *Request) File(name string, data []byte) *Request {
+	return r.Upload(FileParam{FileName: name, Data: data})
+}
+
+// Upload adds a file part, the request is sent as POST
+func (r *Request) Upload(file FileParam) *Request {
+	dup := r.clone()
+	dup.files = append(dup.files, file)
+	dup.method = http.MethodPost
+	return dup
+}
+
+// ParamsInQuery sends the API params of a POST request in the query string
+func (r *Request) ParamsInQuery() *Request {
+	dup := r.clone()
+	dup.query = true
+	return dup
+}
+
+// Idempotent marks a POST request as safe to send twice, so that it is
+// retried on network errors and 5xx like a GET. Only use it for calls
+// that do not create or consume anything.
+func (r *Request) Idempotent() *Request {
+	dup := r.clone()
+	dup.safe = true
+	return dup
+}
+
+// AccessToken overrides the client's access token for this request
+func (r *Request) AccessToken(accessToken string) *Request {
+	dup := r.clone()
+	dup.token = accessToken
+	return dup
+}
+
+// Do sends the request
+func (r *Request) Do(ctx context.Context) (*Response, error) {
+	c := &call{
+		path:      r.path,
+		method:    r.method,
+		sysParams: copyParams(r.client.SysParams),
+		params:    copyParams(r.params),
+		files:     r.files,
+		inQuery:   r.query || r.client.postParamsInQuery,
+		retrySafe: r.safe,
+	}
+	if r.token != "" {
+		c.sysParams["access_token"] = r.token
+	}
+
+	return r.client.execute(ctx, c)
+}
+
+// DoInto sends the request and decodes the data of the response into v
+func (r *Request) DoInto(ctx context.Context, v interface{}) error {
+	resp, err := r.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resp.Data, v); err != nil {
+		return fmt.Errorf("iop: decoding %s: %w", r.path, err)
+	}
+	return nil
+}
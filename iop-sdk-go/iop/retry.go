@@ -0,0 +1,115 @@
+package iop
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryableCodes lists the Lazada error codes that are worth retrying
+var RetryableCodes = map[string]bool{
+	"ApiCallLimit":       true,
+	"AppCallLimit":       true,
+	"ServiceTimeout":     true,
+	"ServiceUnavailable": true,
+}
+
+// RetryPolicy describes how transient failures are retried. Requests that
+// are not idempotent, like POST, are only retried when the gateway throttled
+// them before processing, unless sent with Request.Idempotent.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the computed backoff, a Retry-After header still wins
+	MaxDelay time.Duration
+	// Retryable classifies a failed attempt, DefaultRetryable is used when nil
+	Retryable func(statusCode int, resp *Response, err error) bool
+}
+
+// DefaultRetryPolicy returns the policy used by our sync jobs
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+	}
+}
+
+// DefaultRetryable retries network errors, 429, 5xx and throttling codes
+func DefaultRetryable(statusCode int, resp *Response, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError {
+		return true
+	}
+	if IsRateLimited(err) {
+		return true
+	}
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		return RetryableCodes[respErr.Code]
+	}
+	if err != nil && statusCode == 0 {
+		return true
+	}
+	return resp != nil && RetryableCodes[resp.Code]
+}
+
+func (p *RetryPolicy) retryable(c *call, statusCode int, resp *Response, err error) bool {
+	if !c.idempotent() && !IsRateLimited(err) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(statusCode, resp, err)
+	}
+	return DefaultRetryable(statusCode, resp, err)
+}
+
+// backoff returns the delay before the next attempt, exponential with
+// jitter, or the server's Retry-After when that is longer
+func (p *RetryPolicy) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay << uint(attempt-1)
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// parseRetryAfter understands both the delay-seconds and the http-date form
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
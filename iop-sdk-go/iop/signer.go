@@ -0,0 +1,82 @@
+package iop
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"sort"
+	"strings"
+)
+
+// Signer signs requests, Method is the sign_method sent along
+type Signer interface {
+	Method() string
+	Sign(apiPath string, params map[string]string, secret string) string
+}
+
+// Supported signers
+var (
+	// SignerSHA256 is HMAC-SHA256, the default for current app registrations
+	SignerSHA256 Signer = hmacSigner{method: "sha256", hash: sha256.New}
+	// SignerHMACMD5 is HMAC-MD5, sign_method=hmac
+	SignerHMACMD5 Signer = hmacSigner{method: "hmac", hash: md5.New}
+	// SignerMD5 is MD5 of the message wrapped in the secret, sign_method=md5
+	SignerMD5 Signer = md5Signer{}
+)
+
+// Sign returns the HMAC-SHA256 signature of a request, as the gateway
+// computes it. params must hold every signed param except sign itself.
+func Sign(apiPath string, params map[string]string, secret string) string {
+	return SignerSHA256.Sign(apiPath, params, secret)
+}
+
+// signMessage concatenates the api path and the params sorted by key
+func signMessage(apiPath string, params map[string]string) []byte {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+
+	// sort sys params and api params by key
+	sort.Strings(keys)
+
+	var message bytes.Buffer
+	message.WriteString(apiPath)
+	for _, key := range keys {
+		message.WriteString(key)
+		message.WriteString(params[key])
+	}
+	return message.Bytes()
+}
+
+type hmacSigner struct {
+	method string
+	hash   func() hash.Hash
+}
+
+func (s hmacSigner) Method() string {
+	return s.method
+}
+
+func (s hmacSigner) Sign(apiPath string, params map[string]string, secret string) string {
+	mac := hmac.New(s.hash, []byte(secret))
+	mac.Write(signMessage(apiPath, params))
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil)))
+}
+
+type md5Signer struct{}
+
+func (md5Signer) Method() string {
+	return "md5"
+}
+
+func (md5Signer) Sign(apiPath string, params map[string]string, secret string) string {
+	sum := md5.New()
+	sum.Write([]byte(secret))
+	sum.Write(signMessage(apiPath, params))
+	sum.Write([]byte(secret))
+	return strings.ToUpper(hex.EncodeToString(sum.Sum(nil)))
+}
@@ -0,0 +1,43 @@
+package iop
+
+import "testing"
+
+// The sha256 signature is the example published with the Lazada signing
+// spec: HMAC over the api path followed by every param sorted by key, hex
+// encoded in upper case. The hmac and md5 ones were computed independently
+// from the same message, md5 hashes it wrapped in the secret.
+func TestSigners(t *testing.T) {
+	params := map[string]string{
+		"app_key":      "123456",
+		"timestamp":    "1517820392000",
+		"access_token": "test",
+		"order_id":     "1234",
+	}
+
+	tests := []struct {
+		signer Signer
+		method string
+		want   string
+	}{
+		{SignerSHA256, "sha256", "4190D32361CFB9581350222F345CB77F3B19F0E31D162316848A2C1FFD5FAB4A"},
+		{SignerHMACMD5, "hmac", "F09D543EB3175366D9963BE75DB8E2F8"},
+		{SignerMD5, "md5", "CDEE5AF9E11E929EF75BEB8DC6CD698C"},
+	}
+	for _, tt := range tests {
+		signed := copyParams(params)
+		signed["sign_method"] = tt.signer.Method()
+		if tt.signer.Method() != tt.method {
+			t.Errorf("Method() = %q, want %q", tt.signer.Method(), tt.method)
+		}
+		if got := tt.signer.Sign("/order/get", signed, "helloworld"); got != tt.want {
+			t.Errorf("%s: Sign() = %s, want %s", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestSignMatchesSHA256Signer(t *testing.T) {
+	params := map[string]string{"app_key": "123456", "sign_method": "sha256"}
+	if Sign("/order/get", params, "helloworld") != SignerSHA256.Sign("/order/get", params, "helloworld") {
+		t.Error("Sign and SignerSHA256 disagree")
+	}
+}
@@ -0,0 +1,83 @@
+package iop
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// CountryUserInfo identifies the seller account in one country
+type CountryUserInfo struct {
+	Country   string `json:"country"`
+	UserID    string `json:"user_id"`
+	SellerID  string `json:"seller_id"`
+	ShortCode string `json:"short_code"`
+}
+
+// Token is an access token issued by /auth/token/create or
+// /auth/token/refresh
+type Token struct {
+	AccessToken      string            `json:"access_token"`
+	RefreshToken     string            `json:"refresh_token"`
+	ExpiresIn        int64             `json:"expires_in"`
+	RefreshExpiresIn int64             `json:"refresh_expires_in"`
+	Country          string            `json:"country"`
+	Account          string            `json:"account"`
+	AccountPlatform  string            `json:"account_platform"`
+	CountryUserInfo  []CountryUserInfo `json:"country_user_info"`
+
+	// ExpiresAt and RefreshExpiresAt are computed from the issue time
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Expired reports whether the access token is expired at now
+func (t *Token) Expired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// RefreshExpired reports whether the refresh token is expired at now
+func (t *Token) RefreshExpired(now time.Time) bool {
+	return !now.Before(t.RefreshExpiresAt)
+}
+
+// ExpiresWithin reports whether the access token expires in less than d
+func (t *Token) ExpiresWithin(now time.Time, d time.Duration) bool {
+	return t.Expired(now.Add(d))
+}
+
+// CreateToken exchanges an authorization code for a token. Like every
+// /auth/* API it is sent to the auth gateway, whatever the client's region.
+func (lc *IopClient) CreateToken(ctx context.Context, code string) (*Token, error) {
+	return lc.requestToken(ctx, "/auth/token/create", map[string]string{"code": code})
+}
+
+// RefreshToken renews a token before it expires
+func (lc *IopClient) RefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	return lc.requestToken(ctx, "/auth/token/refresh", map[string]string{"refresh_token": refreshToken})
+}
+
+func (lc *IopClient) requestToken(ctx context.Context, apiPath string, params map[string]string) (*Token, error) {
+	sysParams := copyParams(lc.SysParams)
+	delete(sysParams, "access_token")
+
+	issuedAt := lc.now()
+	resp, err := lc.execute(ctx, &call{
+		path:      apiPath,
+		method:    http.MethodPost,
+		sysParams: sysParams,
+		params:    params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token := &Token{}
+	if err := json.Unmarshal(resp.Body, token); err != nil {
+		return nil, err
+	}
+	token.ExpiresAt = issuedAt.Add(time.Duration(token.ExpiresIn) * time.Second)
+	token.RefreshExpiresAt = issuedAt.Add(time.Duration(token.RefreshExpiresIn) * time.Second)
+	return token, nil
+}
@@ -0,0 +1,240 @@
+package iop
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"lazada/iop-sdk-go/iop/jsonfile"
+)
+
+// ErrTokenNotFound is returned by a TokenStore when no token is stored for
+// the seller
+var ErrTokenNotFound = errors.New("iop: token not found")
+
+// StoredToken is a token together with the seller it belongs to
+type StoredToken struct {
+	SellerID string `json:"seller_id"`
+	Country  string `json:"country"`
+	Token    *Token `json:"token"`
+}
+
+// TokenStore persists tokens keyed by seller ID and country. Countries are
+// compared case-insensitively.
+type TokenStore interface {
+	Get(sellerID, country string) (*Token, error)
+	Put(sellerID, country string, token *Token) error
+	Delete(sellerID, country string) error
+	List() ([]StoredToken, error)
+}
+
+// FileTokenStore is a TokenStore backed by a single JSON file. Every call
+// reads the file and writes hold a file lock, so the store can be shared
+// by several processes, e.g. the onboarding server and the sync service.
+type FileTokenStore struct {
+	path string
+}
+
+// NewFileTokenStore opens the store at path, the file is created on the
+// first Put if it does not exist yet
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	s := &FileTokenStore{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func tokenKey(sellerID, country string) string {
+	return sellerID + "/" + strings.ToUpper(country)
+}
+
+// load reads the tokens from disk keyed by tokenKey
+func (s *FileTokenStore) load() (map[string]StoredToken, error) {
+	var stored []StoredToken
+	if err := jsonfile.Read(s.path, &stored); err != nil {
+		return nil, err
+	}
+	return tokenMap(stored), nil
+}
+
+func tokenMap(stored []StoredToken) map[string]StoredToken {
+	tokens := make(map[string]StoredToken, len(stored))
+	for _, st := range stored {
+		if st.Token == nil {
+			continue
+		}
+		tokens[tokenKey(st.SellerID, st.Country)] = st
+	}
+	return tokens
+}
+
+// update applies fn to the tokens on disk and writes them back under the
+// file lock, so that concurrent writers never drop each other's tokens
+func (s *FileTokenStore) update(fn func(tokens map[string]StoredToken)) error {
+	var stored []StoredToken
+	return jsonfile.Update(s.path, &stored, func() error {
+		tokens := tokenMap(stored)
+		fn(tokens)
+		stored = tokenList(tokens)
+		return nil
+	})
+}
+
+// Get implements TokenStore
+func (s *FileTokenStore) Get(sellerID, country string) (*Token, error) {
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	st, ok := tokens[tokenKey(sellerID, country)]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return st.Token, nil
+}
+
+// Put implements TokenStore
+func (s *FileTokenStore) Put(sellerID, country string, token *Token) error {
+	dup := *token
+	return s.update(func(tokens map[string]StoredToken) {
+		tokens[tokenKey(sellerID, country)] = StoredToken{
+			SellerID: sellerID,
+			Country:  strings.ToUpper(country),
+			Token:    &dup,
+		}
+	})
+}
+
+// Delete implements TokenStore
+func (s *FileTokenStore) Delete(sellerID, country string) error {
+	return s.update(func(tokens map[string]StoredToken) {
+		delete(tokens, tokenKey(sellerID, country))
+	})
+}
+
+// List implements TokenStore
+func (s *FileTokenStore) List() ([]StoredToken, error) {
+	tokens, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return tokenList(tokens), nil
+}
+
+// tokenList returns the tokens sorted by key, so that the file stays stable
+func tokenList(tokens map[string]StoredToken) []StoredToken {
+	keys := make([]string, 0, len(tokens))
+	for key := range tokens {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	stored := make([]StoredToken, 0, len(tokens))
+	for _, key := range keys {
+		stored = append(stored, tokens[key])
+	}
+	return stored
+}
+
+// TokenRefresher renews the tokens of a TokenStore before they expire
+type TokenRefresher struct {
+	Client *IopClient
+	Store  TokenStore
+
+	// Margin is how long before expiry a token is renewed, 24h by default
+	Margin time.Duration
+	// Interval is how often the store is scanned, 1h by default
+	Interval time.Duration
+}
+
+// Run refreshes due tokens immediately and then every Interval until ctx
+// is done
+func (r *TokenRefresher) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Failures are logged by RefreshDue
+		r.RefreshDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshDue renews every token expiring within Margin. It keeps going
+// after a failure and returns the first error, every failure is logged.
+// Tokens whose refresh token expired are logged at WARN, their seller has
+// to authorize the app again.
+func (r *TokenRefresher) RefreshDue(ctx context.Context) error {
+	margin := r.Margin
+	if margin <= 0 {
+		margin = 24 * time.Hour
+	}
+
+	stored, err := r.Store.List()
+	if err != nil {
+		r.Client.log(LevelError, "listing tokens failed", Field{"error", err})
+		return err
+	}
+
+	// A cross-border token is stored once per country, it is refreshed once
+	// and the new token stored for each of them
+	refreshed := map[string]*Token{}
+
+	var firstErr error
+	now := r.Client.now()
+	for _, st := range stored {
+		if !st.Token.ExpiresWithin(now, margin) {
+			continue
+		}
+		if st.Token.RefreshExpired(now) {
+			r.Client.log(LevelWarn, "refresh token expired, seller must re-authorize",
+				Field{"seller_id", st.SellerID},
+				Field{"country", st.Country},
+				Field{"refresh_expires_at", st.Token.RefreshExpiresAt},
+			)
+			continue
+		}
+
+		var err error
+		token, ok := refreshed[st.Token.RefreshToken]
+		if !ok {
+			token, err = r.Client.RefreshToken(ctx, st.Token.RefreshToken)
+			if err == nil {
+				refreshed[st.Token.RefreshToken] = token
+			}
+		}
+		if err == nil {
+			err = r.Store.Put(st.SellerID, st.Country, token)
+		}
+		if err != nil {
+			r.Client.log(LevelError, "token refresh failed",
+				Field{"seller_id", st.SellerID},
+				Field{"country", st.Country},
+				Field{"error", err},
+			)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		r.Client.log(LevelInfo, "token refreshed",
+			Field{"seller_id", st.SellerID},
+			Field{"country", st.Country},
+			Field{"expires_at", token.ExpiresAt},
+		)
+	}
+	return firstErr
+}
@@ -0,0 +1,127 @@
+package iop
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lazada is not consistent about scalar types, the same field can come as
+// a number, a quoted number or a formatted string depending on the API and
+// the region. The types below accept every form seen so far.
+
+// Number is a float64 that also decodes from strings like "1,299.00"
+type Number float64
+
+// UnmarshalJSON implements json.Unmarshaler
+func (n *Number) UnmarshalJSON(data []byte) error {
+	s, ok := unquote(data)
+	if !ok {
+		return nil
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return err
+	}
+	*n = Number(f)
+	return nil
+}
+
+// Int is an int64 that also decodes from quoted numbers
+type Int int64
+
+// UnmarshalJSON implements json.Unmarshaler
+func (i *Int) UnmarshalJSON(data []byte) error {
+	s, ok := unquote(data)
+	if !ok {
+		return nil
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return err
+		}
+		v = int64(f)
+	}
+	*i = Int(v)
+	return nil
+}
+
+// String returns the decimal representation of i
+func (i Int) String() string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// Time decodes "2006-01-02 15:04:05 -0700", RFC 3339 and epoch
+// milliseconds, the zero Time encodes as null
+type Time struct {
+	time.Time
+}
+
+// TimeLayout is the layout of most Lazada timestamps
+const TimeLayout = "2006-01-02 15:04:05 -0700"
+
+var timeLayouts = []string{TimeLayout, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Time) UnmarshalJSON(data []byte) error {
+	s, ok := unquote(data)
+	if !ok {
+		return nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t.Time = time.UnixMilli(ms)
+		return nil
+	}
+
+	var err error
+	for _, layout := range timeLayouts {
+		var parsed time.Time
+		if parsed, err = time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return err
+}
+
+// MarshalJSON implements json.Marshaler
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
+
+// unquote returns the raw scalar, ok is false for null and empty strings
+func unquote(data []byte) (string, bool) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return "", false
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return "", false
+		}
+	}
+	s = strings.TrimSpace(s)
+	return s, s != ""
+}
+
+// FormatTime formats t as the ISO 8601 value expected by list filters such
+// as created_after
+func FormatTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// SetTimeParam sets params[key] to t formatted with FormatTime, a zero t
+// is left out
+func SetTimeParam(params map[string]string, key string, t time.Time) {
+	if !t.IsZero() {
+		params[key] = FormatTime(t)
+	}
+}
@@ -0,0 +1,143 @@
+package iop
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// DefaultFileField is the form field used by AddFileParam, as expected by
+// /image/upload
+const DefaultFileField = "image"
+
+// FileParam is a file sent as a multipart part
+type FileParam struct {
+	// FieldName is the form field, DefaultFileField when empty
+	FieldName string
+	FileName  string
+	// ContentType defaults to application/octet-stream
+	ContentType string
+
+	// Data holds the content, unless Reader is set
+	Data []byte
+	// Reader streams the content without loading it in memory. A streamed
+	// request cannot be replayed, so it is never retried.
+	Reader io.Reader
+}
+
+func (f FileParam) streamed() bool {
+	return f.Reader != nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (f FileParam) write(writer *multipart.Writer) error {
+	field := f.FieldName
+	if field == "" {
+		field = DefaultFileField
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(field), quoteEscaper.Replace(f.FileName)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	if f.Reader != nil {
+		_, err = io.Copy(part, f.Reader)
+		return err
+	}
+	_, err = part.Write(f.Data)
+	return err
+}
+
+// requestBody is an encoded request body. Buffered bodies can be read any
+// number of times, a streamed body is produced by a goroutine and cannot
+// be replayed.
+type requestBody struct {
+	contentType string
+	buffered    []byte
+	stream      func() io.Reader
+}
+
+func (b *requestBody) reader() io.Reader {
+	if b.stream != nil {
+		return b.stream()
+	}
+	return bytes.NewReader(b.buffered)
+}
+
+// newFormBody encodes fields as application/x-www-form-urlencoded
+func newFormBody(fields map[string]string) *requestBody {
+	values := url.Values{}
+	for k, v := range fields {
+		values.Set(k, v)
+	}
+	return &requestBody{
+		contentType: "application/x-www-form-urlencoded",
+		buffered:    []byte(values.Encode()),
+	}
+}
+
+// newMultipartBody encodes fields and files as multipart/form-data
+func newMultipartBody(files []FileParam, fields map[string]string) (*requestBody, error) {
+	streamed := false
+	for _, f := range files {
+		streamed = streamed || f.streamed()
+	}
+
+	write := func(writer *multipart.Writer) error {
+		for k, v := range fields {
+			if err := writer.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			if err := f.write(writer); err != nil {
+				return err
+			}
+		}
+		return writer.Close()
+	}
+
+	if !streamed {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if err := write(writer); err != nil {
+			return nil, err
+		}
+		return &requestBody{contentType: writer.FormDataContentType(), buffered: body.Bytes()}, nil
+	}
+
+	// The boundary is fixed up front so the content type is known before
+	// the body is produced
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	return &requestBody{
+		contentType: "multipart/form-data; boundary=" + boundary,
+		stream: func() io.Reader {
+			// The transport closes the pipe on failure, which unblocks
+			// and ends the writer goroutine
+			pr, pw := io.Pipe()
+			go func() {
+				writer := multipart.NewWriter(pw)
+				if err := writer.SetBoundary(boundary); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+				pw.CloseWithError(write(writer))
+			}()
+			return pr
+		},
+	}, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// JobStatus is the state of a processing job
+type JobStatus string
+
+// Job states
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// maxJobErrors bounds the errors kept per job, the count keeps growing
+const maxJobErrors = 100
+
+// Job is a processing run in the background
+type Job struct {
+	ID   string
+	Kind string
+
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	status     JobStatus
+	totalItems int
+	pagesTotal int
+	pagesDone  int
+	records    int
+	errorCount int
+	errors     []string
+	createdAt  time.Time
+	finishedAt time.Time
+}
+
+// JobSnapshot is the JSON view of a Job
+type JobSnapshot struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Status     JobStatus  `json:"status"`
+	TotalItems int        `json:"total_items"`
+	PagesTotal int        `json:"pages_total"`
+	PagesDone  int        `json:"pages_done"`
+	Records    int        `json:"records"`
+	ErrorCount int        `json:"error_count"`
+	Errors     []string   `json:"errors"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Duration   string     `json:"duration"`
+}
+
+// Snapshot returns a consistent copy of the job state
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snap := JobSnapshot{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Status:     j.status,
+		TotalItems: j.totalItems,
+		PagesTotal: j.pagesTotal,
+		PagesDone:  j.pagesDone,
+		Records:    j.records,
+		ErrorCount: j.errorCount,
+		Errors:     append([]string{}, j.errors...),
+		CreatedAt:  j.createdAt,
+	}
+	end := time.Now()
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		snap.FinishedAt = &finishedAt
+		end = finishedAt
+	}
+	snap.Duration = end.Sub(j.createdAt).Round(time.Millisecond).String()
+	return snap
+}
+
+func (j *Job) setTotal(totalItems, pages int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.totalItems = totalItems
+	j.pagesTotal = pages
+}
+
+func (j *Job) addPage(result pageResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pagesDone++
+	j.records += len(result.Records)
+	if result.Err != nil {
+		j.addErrorLocked(result.Err)
+	}
+}
+
+func (j *Job) addErrorLocked(err error) {
+	j.errorCount++
+	if len(j.errors) < maxJobErrors {
+		j.errors = append(j.errors, err.Error())
+	}
+}
+
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finishedAt = time.Now()
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.status = JobCancelled
+	case err != nil:
+		j.status = JobFailed
+		j.addErrorLocked(err)
+	case j.errorCount > 0:
+		j.status = JobFailed
+	default:
+		j.status = JobSucceeded
+	}
+}
+
+func (j *Job) done() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status != JobRunning
+}
+
+// JobManager runs jobs in process and keeps finished ones for retention
+type JobManager struct {
+	retention time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewJobManager returns a manager forgetting finished jobs after retention
+func NewJobManager(retention time.Duration) *JobManager {
+	return &JobManager{
+		retention: retention,
+		jobs:      map[string]*Job{},
+	}
+}
+
+// Start runs fn in the background, its context is cancelled by Cancel
+func (m *JobManager) Start(kind string, fn func(ctx context.Context, job *Job) error) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		ID:        newJobID(),
+		Kind:      kind,
+		cancel:    cancel,
+		status:    JobRunning,
+		createdAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.evictLocked()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		err := fn(ctx, job)
+		job.finish(err)
+		snap := job.Snapshot()
+		log.Printf("Job %s (%s) %s: %d records, %d errors in %s", job.ID, kind, snap.Status, snap.Records, snap.ErrorCount, snap.Duration)
+	}()
+	return job
+}
+
+// Get returns the job with id
+func (m *JobManager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	return job, ok
+}
+
+// Cancel stops the job with id, it is a no-op for finished jobs
+func (m *JobManager) Cancel(id string) (*Job, bool) {
+	job, ok := m.Get(id)
+	if ok {
+		job.cancel()
+	}
+	return job, ok
+}
+
+// evictLocked drops the jobs finished more than retention ago
+func (m *JobManager) evictLocked() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, job := range m.jobs {
+		if job.done() && job.Snapshot().FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
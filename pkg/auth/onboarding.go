@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"lazada/iop-sdk-go/iop"
+)
+
+const (
+	defaultCookieName = "lazada_oauth_state"
+	defaultStateTTL   = 10 * time.Minute
+)
+
+var errInvalidState = errors.New("invalid oauth state")
+
+// Onboarding runs the seller authorization flow: HandleLogin redirects the
+// browser to Lazada with a signed state bound to a cookie, HandleCallback
+// verifies it, exchanges the code and stores the resulting token.
+type Onboarding struct {
+	// Client must have its CallbackURL set to the HandleCallback route
+	Client *iop.IopClient
+	Store  iop.TokenStore
+
+	// StateSecret signs the state parameter
+	StateSecret []byte
+	// SuccessURL is where the seller lands once the token is stored, the
+	// seller_id and country are added to its query
+	SuccessURL string
+
+	// StateTTL bounds how long the seller has to authorize, 10m by default
+	StateTTL time.Duration
+	// CookieName holds the session nonce, "lazada_oauth_state" by default
+	CookieName string
+	// SecureCookie should be set when served over https
+	SecureCookie bool
+}
+
+func (o *Onboarding) cookieName() string {
+	if o.CookieName != "" {
+		return o.CookieName
+	}
+	return defaultCookieName
+}
+
+func (o *Onboarding) stateTTL() time.Duration {
+	if o.StateTTL > 0 {
+		return o.StateTTL
+	}
+	return defaultStateTTL
+}
+
+// HandleLogin starts the flow
+func (o *Onboarding) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		log.Printf("Error generating oauth nonce: %v", err)
+		http.Error(w, "Failed to start authorization", http.StatusInternalServerError)
+		return
+	}
+
+	ttl := o.stateTTL()
+	session := hex.EncodeToString(nonce)
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    session,
+		Path:     "/",
+		MaxAge:   int(ttl / time.Second),
+		HttpOnly: true,
+		Secure:   o.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	state := o.signState(session, time.Now().Add(ttl))
+	http.Redirect(w, r, o.Client.MakeAuthURLWithState(state), http.StatusFound)
+}
+
+// HandleCallback completes the flow
+func (o *Onboarding) HandleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	cookie, err := r.Cookie(o.cookieName())
+	if err != nil || o.verifyState(query.Get("state"), cookie.Value, time.Now()) != nil {
+		log.Printf("Rejected oauth callback with invalid state")
+		http.Error(w, "Invalid or expired authorization request", http.StatusBadRequest)
+		return
+	}
+
+	// The state is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "Authorization code not found", http.StatusBadRequest)
+		return
+	}
+
+	token, err := o.Client.CreateToken(r.Context(), code)
+	if err != nil {
+		log.Printf("Error exchanging code for access token: %v", err)
+		http.Error(w, "Failed to authorize seller", http.StatusBadGateway)
+		return
+	}
+
+	// A cross-border token has country "cb" and covers every country of
+	// country_user_info, each with its own seller ID
+	var accounts []iop.CountryUserInfo
+	for _, info := range token.CountryUserInfo {
+		if info.SellerID != "" && info.Country != "" {
+			accounts = append(accounts, info)
+		}
+	}
+	if len(accounts) == 0 {
+		log.Printf("Token for country %q carries no seller ID", token.Country)
+		http.Error(w, "Failed to authorize seller", http.StatusBadGateway)
+		return
+	}
+
+	for _, account := range accounts {
+		if err := o.Store.Put(account.SellerID, account.Country, token); err != nil {
+			log.Printf("Error storing token for seller %s: %v", account.SellerID, err)
+			http.Error(w, "Failed to store authorization", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Seller %s (%s) authorized, token expires at %s", account.SellerID, account.Country, token.ExpiresAt.Format(time.RFC3339))
+	}
+
+	http.Redirect(w, r, o.successURL(accounts[0].SellerID, accounts[0].Country), http.StatusFound)
+}
+
+func (o *Onboarding) successURL(sellerID, country string) string {
+	target, err := url.Parse(o.SuccessURL)
+	if err != nil {
+		return o.SuccessURL
+	}
+	params := target.Query()
+	params.Set("seller_id", sellerID)
+	params.Set("country", country)
+	target.RawQuery = params.Encode()
+	return target.String()
+}
+
+// signState returns "<session>.<expiry>.<mac>"
+func (o *Onboarding) signState(session string, expiry time.Time) string {
+	payload := session + "." + strconv.FormatInt(expiry.Unix(), 10)
+	return payload + "." + o.mac(payload)
+}
+
+// verifyState checks the state was issued by us, for this session, and
+// has not expired
+func (o *Onboarding) verifyState(state, session string, now time.Time) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 || session == "" {
+		return errInvalidState
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(o.mac(payload))) {
+		return errInvalidState
+	}
+	if !hmac.Equal([]byte(parts[0]), []byte(session)) {
+		return errInvalidState
+	}
+
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.After(time.Unix(expiry, 0)) {
+		return errInvalidState
+	}
+	return nil
+}
+
+func (o *Onboarding) mac(payload string) string {
+	hash := hmac.New(sha256.New, o.StateSecret)
+	hash.Write([]byte(payload))
+	return hex.EncodeToString(hash.Sum(nil))
+}
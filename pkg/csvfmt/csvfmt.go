@@ -0,0 +1,20 @@
+// Package csvfmt formats the values of the CSV rows of normalized records
+package csvfmt
+
+import (
+	"strconv"
+	"time"
+)
+
+// Time formats t as RFC 3339, a zero t is an empty cell
+func Time(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Float formats f with as few digits as needed and no exponent
+func Float(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
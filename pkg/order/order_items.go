@@ -0,0 +1,43 @@
+package order
+
+import (
+	"context"
+
+	"lazada/iop-sdk-go/iop"
+	"lazada/iop-sdk-go/iop/orders"
+
+	"github.com/tidwall/gjson"
+)
+
+// OrderIDs returns the order_id of every order in an /orders/get response
+func OrderIDs(responseData string) []int64 {
+	var ids []int64
+	gjson.Get(responseData, "orders.#.order_id").ForEach(func(_, id gjson.Result) bool {
+		ids = append(ids, id.Int())
+		return true
+	})
+	return ids
+}
+
+// FetchOrderItems loads the items of orderIDs with /orders/items/get,
+// batched by orders.MaxOrderIDs, keyed by order ID
+func FetchOrderItems(ctx context.Context, client *iop.IopClient, orderIDs []int64) (map[int64][]orders.OrderItem, error) {
+	api := orders.New(client)
+	items := make(map[int64][]orders.OrderItem, len(orderIDs))
+
+	for start := 0; start < len(orderIDs); start += orders.MaxOrderIDs {
+		end := start + orders.MaxOrderIDs
+		if end > len(orderIDs) {
+			end = len(orderIDs)
+		}
+
+		batch, err := api.GetMultipleOrderItems(ctx, orderIDs[start:end])
+		if err != nil {
+			return items, err
+		}
+		for _, order := range batch {
+			items[int64(order.OrderID)] = order.OrderItems
+		}
+	}
+	return items, nil
+}
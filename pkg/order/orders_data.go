@@ -2,49 +2,138 @@ package order
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"strconv"
+	"time"
 
-	"github.com/tidwall/gjson"
+	"lazada/iop-sdk-go/iop/orders"
+	"lazada/pkg/csvfmt"
 )
 
-func ProcessOrders(responseData string) string {
+// SchemaVersion is the version of NormalizedOrder, bumped on any breaking
+// change to its JSON form
+const SchemaVersion = 1
+
+// NormalizedOrder is the generalized form of an order
+type NormalizedOrder struct {
+	SchemaVersion       int                   `json:"schema_version"`
+	OrderID             string                `json:"order_id"`
+	CreatedAt           time.Time             `json:"created_at"`
+	UpdatedAt           time.Time             `json:"updated_at"`
+	Price               float64               `json:"price"`
+	VoucherPlatform     float64               `json:"voucher_platform"`
+	VoucherSeller       float64               `json:"voucher_seller"`
+	ShippingFeeDiscount float64               `json:"shipping_fee_discount"`
+	WarehouseCode       string                `json:"warehouse_code"`
+	ShippingFee         float64               `json:"shipping_fee"`
+	ItemsCount          int                   `json:"items_count"`
+	Items               []NormalizedOrderItem `json:"items,omitempty"`
+}
+
+// NormalizedOrderItem is the generalized form of an order line
+type NormalizedOrderItem struct {
+	OrderItemID      int64   `json:"order_item_id"`
+	Sku              string  `json:"sku"`
+	ShopSku          string  `json:"shop_sku"`
+	Name             string  `json:"name"`
+	ItemPrice        float64 `json:"item_price"`
+	PaidPrice        float64 `json:"paid_price"`
+	TaxAmount        float64 `json:"tax_amount"`
+	TrackingCode     string  `json:"tracking_code"`
+	ShipmentProvider string  `json:"shipment_provider"`
+	Status           string  `json:"status"`
+}
+
+// ProcessOrders normalizes the orders of an /orders/get response
+func ProcessOrders(responseData string) ([]NormalizedOrder, error) {
+	return ProcessOrdersWithItems(responseData, nil)
+}
+
+// ProcessOrdersWithItems is like ProcessOrders but nests the line items of
+// each order, keyed by order ID as returned by FetchOrderItems
+func ProcessOrdersWithItems(responseData string, items map[int64][]orders.OrderItem) ([]NormalizedOrder, error) {
 	// Parse the response data to get orders
-	orders := gjson.Get(responseData, "orders")
-	if !orders.Exists() {
-		log.Println("No orders found in response.")
-		return "No Orders Found"
+	var page orders.OrdersPage
+	if err := json.Unmarshal([]byte(responseData), &page); err != nil {
+		return nil, fmt.Errorf("parsing orders: %w", err)
 	}
 
-	// Slice to hold the generalized JSON
-	var generalizedOrders []map[string]interface{}
-
 	// Loop through each order and extract necessary fields
-	orders.ForEach(func(_, order gjson.Result) bool {
-		generalizedOrder := map[string]interface{}{
-			"order_id":              order.Get("order_number").String(),
-			"created_at":            order.Get("created_at").String(),
-			"updated_at":            order.Get("updated_at").String(),
-			"price":                 order.Get("price").Float(),
-			"voucher_platform":      order.Get("voucher_platform").Float(),
-			"voucher_seller":        order.Get("voucher_seller").Float(),
-			"shipping_fee_discount": order.Get("shipping_fee_discount_platform").Float(),
-			"warehouse_code":        order.Get("warehouse_code").String(),
-			"shipping_fee":          order.Get("shipping_fee_original").Float(),
-			"items_count":           order.Get("items_count").Int(),
+	normalized := make([]NormalizedOrder, 0, len(page.Orders))
+	for _, order := range page.Orders {
+		normalizedOrder := NormalizedOrder{
+			SchemaVersion:       SchemaVersion,
+			OrderID:             order.OrderNumber.String(),
+			CreatedAt:           order.CreatedAt.Time,
+			UpdatedAt:           order.UpdatedAt.Time,
+			Price:               float64(order.Price),
+			VoucherPlatform:     float64(order.VoucherPlatform),
+			VoucherSeller:       float64(order.VoucherSeller),
+			ShippingFeeDiscount: float64(order.ShippingFeeDiscountPlatform),
+			WarehouseCode:       order.WarehouseCode,
+			ShippingFee:         float64(order.ShippingFeeOriginal),
+			ItemsCount:          order.ItemsCount,
+		}
+		if items != nil {
+			normalizedOrder.Items = normalizeItems(items[int64(order.OrderID)])
 		}
-		generalizedOrders = append(generalizedOrders, generalizedOrder)
-		return true
-	})
-
-	// Convert to JSON for use or storage
-	generalizedJSON, err := json.MarshalIndent(generalizedOrders, "", "  ")
-	if err != nil {
-		log.Fatalf("Error marshalling generalized orders: %v", err)
+		normalized = append(normalized, normalizedOrder)
 	}
 
-	log.Println("Generalized JSON:")
-	log.Println(string(generalizedJSON))
+	return normalized, nil
+}
 
-	// Return the JSON as string
-	return string(generalizedJSON)
+func normalizeItems(items []orders.OrderItem) []NormalizedOrderItem {
+	normalizedItems := make([]NormalizedOrderItem, 0, len(items))
+	for _, item := range items {
+		normalizedItems = append(normalizedItems, NormalizedOrderItem{
+			OrderItemID:      int64(item.OrderItemID),
+			Sku:              item.Sku,
+			ShopSku:          item.ShopSku,
+			Name:             item.Name,
+			ItemPrice:        float64(item.ItemPrice),
+			PaidPrice:        float64(item.PaidPrice),
+			TaxAmount:        float64(item.TaxAmount),
+			TrackingCode:     item.TrackingCode,
+			ShipmentProvider: item.ShipmentProvider,
+			Status:           item.Status,
+		})
+	}
+	return normalizedItems
+}
+
+// RecordID returns the order number, it identifies the order across syncs
+func (o NormalizedOrder) RecordID() string {
+	return o.OrderID
+}
+
+// RecordUpdatedAt returns when the order was last updated
+func (o NormalizedOrder) RecordUpdatedAt() time.Time {
+	return o.UpdatedAt
+}
+
+// CSVHeader returns the columns of CSVRow
+func (NormalizedOrder) CSVHeader() []string {
+	return []string{
+		"schema_version", "order_id", "created_at", "updated_at", "price",
+		"voucher_platform", "voucher_seller", "shipping_fee_discount",
+		"warehouse_code", "shipping_fee", "items_count",
+	}
+}
+
+// CSVRow flattens the order header, items are only kept in the JSON form
+func (o NormalizedOrder) CSVRow() []string {
+	return []string{
+		strconv.Itoa(o.SchemaVersion),
+		o.OrderID,
+		csvfmt.Time(o.CreatedAt),
+		csvfmt.Time(o.UpdatedAt),
+		csvfmt.Float(o.Price),
+		csvfmt.Float(o.VoucherPlatform),
+		csvfmt.Float(o.VoucherSeller),
+		csvfmt.Float(o.ShippingFeeDiscount),
+		o.WarehouseCode,
+		csvfmt.Float(o.ShippingFee),
+		strconv.Itoa(o.ItemsCount),
+	}
 }
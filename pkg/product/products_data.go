@@ -2,49 +2,204 @@ package product
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
+	"strconv"
+	"time"
 
-	"github.com/tidwall/gjson"
+	"lazada/iop-sdk-go/iop/products"
+	"lazada/pkg/csvfmt"
 )
 
-func ProcessProducts(responseData string) string {
+// SchemaVersion is the version of NormalizedProduct, bumped on any
+// breaking change to its JSON form
+const SchemaVersion = 1
+
+// NormalizedProduct is the generalized form of a product. Price, special
+// price and quantity are aggregated over every SKU rather than read from
+// the first one.
+type NormalizedProduct struct {
+	SchemaVersion int             `json:"schema_version"`
+	ItemID        int64           `json:"item_id"`
+	Name          string          `json:"name"`
+	Brand         string          `json:"brand"`
+	Status        string          `json:"status"`
+	CreatedTime   time.Time       `json:"created_time"`
+	UpdatedTime   time.Time       `json:"updated_time"`
+	Price         float64         `json:"price"`
+	SpecialPrice  float64         `json:"special_price"`
+	Quantity      int64           `json:"quantity"`
+	URL           string          `json:"url"`
+	Images        []string        `json:"images"`
+	Skus          []NormalizedSKU `json:"skus"`
+	Totals        ProductTotals   `json:"totals"`
+}
+
+// NormalizedSKU is the generalized form of a product variant
+type NormalizedSKU struct {
+	SellerSku      string            `json:"seller_sku"`
+	ShopSku        string            `json:"shop_sku"`
+	SkuID          int64             `json:"sku_id"`
+	Status         string            `json:"status"`
+	Price          float64           `json:"price"`
+	SpecialPrice   float64           `json:"special_price"`
+	SpecialFrom    *time.Time        `json:"special_from,omitempty"`
+	SpecialTo      *time.Time        `json:"special_to,omitempty"`
+	Quantity       int64             `json:"quantity"`
+	SellableStock  int64             `json:"sellable_stock"`
+	Available      int64             `json:"available"`
+	Variation      map[string]string `json:"variation"`
+	PackageWidth   float64           `json:"package_width"`
+	PackageHeight  float64           `json:"package_height"`
+	PackageLength  float64           `json:"package_length"`
+	PackageWeight  float64           `json:"package_weight"`
+	PackageContent string            `json:"package_content"`
+	URL            string            `json:"url"`
+}
+
+// ProductTotals aggregates the SKUs of a product
+type ProductTotals struct {
+	SkuCount           int     `json:"sku_count"`
+	TotalQuantity      int64   `json:"total_quantity"`
+	TotalSellableStock int64   `json:"total_sellable_stock"`
+	TotalAvailable     int64   `json:"total_available"`
+	MinPrice           float64 `json:"min_price"`
+	MaxPrice           float64 `json:"max_price"`
+	MinSpecialPrice    float64 `json:"min_special_price"`
+}
+
+// ProcessProducts normalizes the products of a /products/get response
+func ProcessProducts(responseData string) ([]NormalizedProduct, error) {
 	// Parse the response data to get products
-	products := gjson.Get(responseData, "products")
-	if !products.Exists() {
-		log.Println("No products found in response.")
-		return "No Products Found"
+	var page products.ProductsPage
+	if err := json.Unmarshal([]byte(responseData), &page); err != nil {
+		return nil, fmt.Errorf("parsing products: %w", err)
 	}
 
-	// Slice to hold the generalized JSON
-	var generalizedProducts []map[string]interface{}
-
 	// Loop through each product and extract necessary fields
-	products.ForEach(func(_, product gjson.Result) bool {
-		generalizedProduct := map[string]interface{}{
-			"item_id":       product.Get("item_id").Int(),
-			"name":          product.Get("attributes.name").String(),
-			"brand":         product.Get("attributes.brand").String(),
-			"status":        product.Get("status").String(),
-			"created_time":  product.Get("created_time").String(),
-			"updated_time":  product.Get("updated_time").String(),
-			"price":         product.Get("skus.0.price").Float(),
-			"special_price": product.Get("skus.0.special_price").Float(),
-			"quantity":      product.Get("skus.0.quantity").Int(),
-			"url":           product.Get("skus.0.Url").String(),
-			"images":        product.Get("images").Array(),
+	normalized := make([]NormalizedProduct, 0, len(page.Products))
+	for _, product := range page.Products {
+		totals := aggregateSkus(product.Skus)
+
+		url := ""
+		if len(product.Skus) > 0 {
+			url = product.Skus[0].URL
+		}
+
+		normalized = append(normalized, NormalizedProduct{
+			SchemaVersion: SchemaVersion,
+			ItemID:        int64(product.ItemID),
+			Name:          product.Attributes.Name,
+			Brand:         product.Attributes.Brand,
+			Status:        product.Status,
+			CreatedTime:   product.CreatedTime.Time,
+			UpdatedTime:   product.UpdatedTime.Time,
+			Price:         totals.MinPrice,
+			SpecialPrice:  totals.MinSpecialPrice,
+			Quantity:      totals.TotalQuantity,
+			URL:           url,
+			Images:        product.Images,
+			Skus:          normalizeSkus(product.Skus),
+			Totals:        totals,
+		})
+	}
+
+	return normalized, nil
+}
+
+func normalizeSkus(skus []products.SKU) []NormalizedSKU {
+	normalizedSkus := make([]NormalizedSKU, 0, len(skus))
+	for _, sku := range skus {
+		normalizedSkus = append(normalizedSkus, NormalizedSKU{
+			SellerSku:      sku.SellerSku,
+			ShopSku:        sku.ShopSku,
+			SkuID:          int64(sku.SkuID),
+			Status:         sku.Status,
+			Price:          float64(sku.Price),
+			SpecialPrice:   float64(sku.SpecialPrice),
+			SpecialFrom:    optionalTime(sku.SpecialFrom.Time),
+			SpecialTo:      optionalTime(sku.SpecialTo.Time),
+			Quantity:       int64(sku.Quantity),
+			SellableStock:  int64(sku.SellableStock),
+			Available:      int64(sku.Available),
+			Variation:      sku.Variation,
+			PackageWidth:   float64(sku.PackageWidth),
+			PackageHeight:  float64(sku.PackageHeight),
+			PackageLength:  float64(sku.PackageLength),
+			PackageWeight:  float64(sku.PackageWeight),
+			PackageContent: sku.PackageContent,
+			URL:            sku.URL,
+		})
+	}
+	return normalizedSkus
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// aggregateSkus sums the stock of every SKU and returns the price range,
+// a special price of 0 means the SKU has none and is skipped
+func aggregateSkus(skus []products.SKU) ProductTotals {
+	totals := ProductTotals{SkuCount: len(skus)}
+	for i, sku := range skus {
+		totals.TotalQuantity += int64(sku.Quantity)
+		totals.TotalSellableStock += int64(sku.SellableStock)
+		totals.TotalAvailable += int64(sku.Available)
+
+		price := float64(sku.Price)
+		if i == 0 || price < totals.MinPrice {
+			totals.MinPrice = price
+		}
+		if price > totals.MaxPrice {
+			totals.MaxPrice = price
+		}
+		if special := float64(sku.SpecialPrice); special > 0 && (totals.MinSpecialPrice == 0 || special < totals.MinSpecialPrice) {
+			totals.MinSpecialPrice = special
 		}
-		generalizedProducts = append(generalizedProducts, generalizedProduct)
-		return true
-	})
-
-	// Convert to JSON for use or storage
-	generalizedJSON, err := json.MarshalIndent(generalizedProducts, "", "  ")
-	if err != nil {
-		log.Fatalf("Error marshalling generalized products: %v", err)
 	}
+	return totals
+}
+
+// RecordID returns the item ID, it identifies the product across syncs
+func (p NormalizedProduct) RecordID() string {
+	return strconv.FormatInt(p.ItemID, 10)
+}
+
+// RecordUpdatedAt returns when the product was last updated
+func (p NormalizedProduct) RecordUpdatedAt() time.Time {
+	return p.UpdatedTime
+}
 
-	log.Println("Generalized JSON:")
-	log.Println(string(generalizedJSON))
+// CSVHeader returns the columns of CSVRow
+func (NormalizedProduct) CSVHeader() []string {
+	return []string{
+		"schema_version", "item_id", "name", "brand", "status", "created_time",
+		"updated_time", "price", "special_price", "quantity", "url",
+		"sku_count", "total_sellable_stock", "total_available", "max_price",
+	}
+}
 
-	return string(generalizedJSON)
+// CSVRow flattens the product and its totals, SKUs are only kept in the
+// JSON form
+func (p NormalizedProduct) CSVRow() []string {
+	return []string{
+		strconv.Itoa(p.SchemaVersion),
+		strconv.FormatInt(p.ItemID, 10),
+		p.Name,
+		p.Brand,
+		p.Status,
+		csvfmt.Time(p.CreatedTime),
+		csvfmt.Time(p.UpdatedTime),
+		csvfmt.Float(p.Price),
+		csvfmt.Float(p.SpecialPrice),
+		strconv.FormatInt(p.Quantity, 10),
+		p.URL,
+		strconv.Itoa(p.Totals.SkuCount),
+		strconv.FormatInt(p.Totals.TotalSellableStock, 10),
+		strconv.FormatInt(p.Totals.TotalAvailable, 10),
+		csvfmt.Float(p.Totals.MaxPrice),
+	}
 }
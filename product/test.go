@@ -1,15 +1,12 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net/http"
-	"sync"
 
 	"lazada/iop-sdk-go/iop"
 
 	"github.com/labstack/echo/v4"
-	"github.com/tidwall/gjson"
 )
 
 type RequestPayload struct {
@@ -17,11 +14,6 @@ type RequestPayload struct {
 	CreatedAfter string `json:"created_after"`
 }
 
-type ProductTask struct {
-	Offset int
-	Limit  int
-}
-
 func main() {
 	e := echo.New()
 
@@ -66,77 +58,32 @@ func handleProductProcessing(c echo.Context) error {
 	// Lazada client configuration
 	client := iop.NewClient(&clientOptions)
 	client.SetAccessToken(payload.AccessToken)
-	// Get total order count
-	client.AddAPIParam("created_after", payload.CreatedAfter)
 
-	// Get total product count
-	totalProducts, err := getTotalProductCount(client)
+	// Get total products count, then fan out one request per page
+	pagination, err := iop.Paginate(c.Request().Context(), client, "/products/get",
+		map[string]string{"created_after": payload.CreatedAfter},
+		iop.PaginateOptions{
+			CountPath:   "total_products",
+			PageSize:    18,
+			Concurrency: 5, // Adjust based on system resources
+		})
 	if err != nil {
 		log.Printf("Error fetching total products: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch product count"})
 	}
 
-	log.Printf("Payload: %+v", payload)
-	log.Printf("Total products to process: %d", totalProducts)
-
-	// Worker pool and concurrency setup
-	limit := 18
-	numWorkers := 5 // Adjust based on system resources
-	tasks := make(chan ProductTask, totalProducts)
-	results := make(chan string, totalProducts)
-	var wg sync.WaitGroup
-
-	// Start worker goroutines
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go productWorker(clientOptions, payload.AccessToken, tasks, results, &wg)
-	}
-
-	// Send tasks to the worker pool
-	for offset := 0; offset < totalProducts; offset += limit {
-		tasks <- ProductTask{Offset: offset, Limit: limit}
-	}
-	close(tasks)
-
-	// Wait for all workers to complete
-	wg.Wait()
-	close(results)
+	log.Printf("Total products to process: %d", pagination.Total)
 
 	// Process results
-	for result := range results {
-		log.Printf("Processed data: %s", result)
+	for page := range pagination.Pages {
+		if page.Err != nil {
+			log.Printf("Error fetching products for offset %d: %v", page.Offset, page.Err)
+			continue
+		}
+		log.Printf("Processed data: %s", page.Response.Data)
 	}
 
 	// Return success response
 	log.Println("Products processed successfully")
 	return c.JSON(http.StatusOK, map[string]string{"message": "Products processed successfully"})
 }
-
-func getTotalProductCount(client *iop.IopClient) (int, error) {
-	getResult, err := client.Execute("/products/get", "GET", nil)
-	if err != nil {
-		return 0, err
-	}
-
-	response := string(getResult.Data)
-	return int(gjson.Get(response, "data.total_products").Int()), nil
-}
-
-func productWorker(clientOptions iop.ClientOptions, accessToken string, tasks <-chan ProductTask, results chan<- string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for task := range tasks {
-		client := iop.NewClient(&clientOptions)
-		client.SetAccessToken(accessToken)
-		client.AddAPIParam("offset", fmt.Sprintf("%d", task.Offset))
-		client.AddAPIParam("limit", fmt.Sprintf("%d", task.Limit))
-
-		getResult, err := client.Execute("/products/get", "GET", nil)
-		if err != nil {
-			log.Printf("Error fetching products for offset %d: %v", task.Offset, err)
-			continue
-		}
-
-		results <- string(getResult.Data)
-	}
-}
@@ -1,38 +1,97 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"sync"
+	"time"
 
 	"lazada/iop-sdk-go/iop"
+	"lazada/iop-sdk-go/iop/orders"
+	"lazada/iop-sdk-go/iop/products"
 	"lazada/pkg/order"
 	"lazada/pkg/product"
 
 	"github.com/labstack/echo/v4"
-	"github.com/tidwall/gjson"
 )
 
 type RequestPayload struct {
 	AccessToken  string `json:"access_token"`
+	SellerID     string `json:"seller_id"`
+	Country      string `json:"country"`
 	CreatedAfter string `json:"created_after"`
+	Sink         string `json:"sink"`
+	// Incremental resumes from the stored cursor of the seller, only new
+	// and changed records are emitted. CreatedAfter is the starting point
+	// of the first run.
+	Incremental bool `json:"incremental"`
 }
 
-type Task struct {
-	Offset int
-	Limit  int
-}
+// ProcessFunc turns one fetched page into normalized records, client can
+// be used to enrich the page with further API calls
+type ProcessFunc func(ctx context.Context, client *iop.IopClient, responseData string) ([]interface{}, error)
 
-type WorkerConfig struct {
+// Service holds the dependencies shared by every handler
+type Service struct {
 	ClientOptions iop.ClientOptions
-	AccessToken   string
-	CreatedAfter  string
-	Endpoint      string
-	ProcessFunc   func(string) string
+	Tokens        iop.TokenStore
+	Cursors       CursorStore
+	// SyncOverlap is how far back incremental runs re-query before the
+	// cursor, to catch updates that landed late
+	SyncOverlap time.Duration
+
+	sinks *sinks
+	jobs  *JobManager
+
+	// syncing holds the cursor keys of the incremental runs in progress
+	syncMu  sync.Mutex
+	syncing map[string]bool
 }
 
 func main() {
+	// Tokens are persisted per seller and renewed in the background
+	tokens, err := iop.NewFileTokenStore(getEnv("LAZADA_TOKEN_STORE", "tokens.json"))
+	if err != nil {
+		log.Fatalf("Error opening token store: %v", err)
+	}
+
+	// Incremental sync cursors are persisted per seller and endpoint
+	cursors, err := NewFileCursorStore(getEnv("LAZADA_CURSOR_STORE", "cursors.json"))
+	if err != nil {
+		log.Fatalf("Error opening cursor store: %v", err)
+	}
+	overlap, err := time.ParseDuration(getEnv("LAZADA_SYNC_OVERLAP", "10m"))
+	if err != nil {
+		log.Fatalf("Invalid LAZADA_SYNC_OVERLAP: %v", err)
+	}
+
+	svc := &Service{
+		ClientOptions: newClientOptions(),
+		Tokens:        tokens,
+		Cursors:       cursors,
+		SyncOverlap:   overlap,
+		sinks: newSinks(SinkConfig{
+			Default:    getEnv("LAZADA_SINK", SinkNone),
+			Dir:        getEnv("LAZADA_SINK_DIR", "output"),
+			WebhookURL: os.Getenv("LAZADA_WEBHOOK_URL"),
+		}),
+		jobs: NewJobManager(time.Hour),
+	}
+	if err := svc.ClientOptions.Validate(); err != nil {
+		log.Fatalf("Invalid Lazada client configuration: %v", err)
+	}
+
+	// The refresher logs failures and expired refresh tokens, surface them
+	refresher := &iop.TokenRefresher{
+		Client: iop.NewClient(&svc.ClientOptions).SetLogger(iop.NewStdLogger(nil, iop.LevelWarn)),
+		Store:  tokens,
+	}
+	go refresher.Run(context.Background())
+
 	e := echo.New()
 
 	// Middleware for logging requests
@@ -43,127 +102,411 @@ func main() {
 		}
 	})
 
-	// Define the POST endpoints
+	// Define the POST endpoints, they start a job and answer 202 Accepted
 	e.POST("/process-products", func(c echo.Context) error {
-		return handleProcessing(c, "/products/get", "total_products", product.ProcessProducts)
+		return svc.handleProcessing(c, productsEndpoint)
 	})
 	e.POST("/process-orders", func(c echo.Context) error {
-		return handleProcessing(c, "/orders/get", "countTotal", order.ProcessOrders)
+		return svc.handleProcessing(c, ordersEndpoint)
 	})
 
+	// Streaming variants answer with NDJSON, or SSE with ?format=sse
+	e.POST("/process-products/stream", func(c echo.Context) error {
+		return svc.handleStream(c, productsEndpoint)
+	})
+	e.POST("/process-orders/stream", func(c echo.Context) error {
+		return svc.handleStream(c, ordersEndpoint)
+	})
+
+	e.GET("/jobs/:id", svc.handleGetJob)
+	e.DELETE("/jobs/:id", svc.handleCancelJob)
+
 	// Start the server
 	log.Println("Server started on :8091")
 	e.Logger.Fatal(e.Start(":8091"))
 }
 
-func handleProcessing(c echo.Context, endpoint, countKey string, processFunc func(string) string) error {
+func processProducts(_ context.Context, _ *iop.IopClient, responseData string) ([]interface{}, error) {
+	normalized, err := product.ProcessProducts(responseData)
+	return records(normalized), err
+}
+
+// processOrders nests the line items of every order of the page. The page
+// fails if its items cannot be fetched, rather than emitting orders that
+// look like they have no lines.
+func processOrders(ctx context.Context, client *iop.IopClient, responseData string) ([]interface{}, error) {
+	items, err := order.FetchOrderItems(ctx, client, order.OrderIDs(responseData))
+	if err != nil {
+		return nil, fmt.Errorf("fetching order items: %w", err)
+	}
+	normalized, err := order.ProcessOrdersWithItems(responseData, items)
+	return records(normalized), err
+}
+
+func records[T any](values []T) []interface{} {
+	out := make([]interface{}, len(values))
+	for i := range values {
+		out[i] = values[i]
+	}
+	return out
+}
+
+// newClientOptions returns the Lazada app configuration
+func newClientOptions() iop.ClientOptions {
+	return iop.ClientOptions{
+		APIKey:    "131151",
+		APISecret: "pA96smss38jIXWepIxl34VtfVMaDrChx",
+		Region:    "MY",
+		Retry:     iop.DefaultRetryPolicy(),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
+// country returns the payload's country, the client region by default
+func (s *Service) country(payload *RequestPayload) string {
+	if payload.Country != "" {
+		return payload.Country
+	}
+	return string(s.ClientOptions.Region)
+}
+
+// accessToken returns the token from the payload, or the stored token of
+// the payload's seller
+func (s *Service) accessToken(payload *RequestPayload) (string, error) {
+	if payload.AccessToken != "" {
+		return payload.AccessToken, nil
+	}
+
+	token, err := s.Tokens.Get(payload.SellerID, s.country(payload))
+	if err != nil {
+		return "", err
+	}
+	if token.Expired(time.Now()) {
+		return "", iop.ErrInvalidToken
+	}
+	return token.AccessToken, nil
+}
+
+// Endpoint describes a Lazada list API processed by the service
+type Endpoint struct {
+	Kind     string
+	Path     string
+	CountKey string
+	// PageSize is the largest limit the API accepts, full pages keep the
+	// enrichment batches of Process full too
+	PageSize int
+	Process  ProcessFunc
+	// Params returns the filter of a full run over the records created
+	// after createdAfter
+	Params func(createdAfter time.Time) map[string]string
+	// IncrementalParams returns the filter of one update window of an
+	// incremental run
+	IncrementalParams func(updateAfter, updateBefore time.Time) map[string]string
+}
+
+var (
+	productsEndpoint = Endpoint{Kind: "products", Path: "/products/get", CountKey: "total_products", PageSize: products.MaxLimit, Process: processProducts,
+		Params: func(createdAfter time.Time) map[string]string {
+			return products.GetProductsRequest{CreatedAfter: createdAfter}.Params()
+		},
+		IncrementalParams: func(updateAfter, updateBefore time.Time) map[string]string {
+			return products.GetProductsRequest{UpdateAfter: updateAfter, UpdateBefore: updateBefore}.Params()
+		},
+	}
+	ordersEndpoint = Endpoint{Kind: "orders", Path: "/orders/get", CountKey: "countTotal", PageSize: orders.MaxLimit, Process: processOrders,
+		Params: func(createdAfter time.Time) map[string]string {
+			return orders.GetOrdersRequest{CreatedAfter: createdAfter}.Params()
+		},
+		IncrementalParams: func(updateAfter, updateBefore time.Time) map[string]string {
+			return orders.GetOrdersRequest{
+				UpdateAfter:   updateAfter,
+				UpdateBefore:  updateBefore,
+				SortBy:        orders.SortByUpdatedAt,
+				SortDirection: orders.SortAsc,
+			}.Params()
+		},
+	}
+)
+
+// processRequest is a validated processing request, ready to run
+type processRequest struct {
+	endpoint     Endpoint
+	payload      *RequestPayload
+	createdAfter time.Time
+	client       *iop.IopClient
+	sink         Sink
+	sync         *syncState
+}
+
+// requestError is a validation failure reported to the caller as is
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// pageResult is one processed page, Err is set if it could not be
+// fetched, processed or written to the sink
+type pageResult struct {
+	Offset  int
+	Records []interface{}
+	Err     error
+}
+
+// prepare binds and validates the payload, resolves the token and sink
+func (s *Service) prepare(c echo.Context, endpoint Endpoint) (*processRequest, error) {
 	// Bind the request payload
 	payload := new(RequestPayload)
 	if err := c.Bind(payload); err != nil {
 		log.Printf("Error binding payload: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		return nil, &requestError{http.StatusBadRequest, "Invalid request payload"}
 	}
 
 	// Validate required fields
-	if payload.AccessToken == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing or invalid fields"})
+	if payload.AccessToken == "" && payload.SellerID == "" {
+		return nil, &requestError{http.StatusBadRequest, "Missing or invalid fields"}
+	}
+	var createdAfter time.Time
+	if payload.CreatedAfter != "" {
+		var err error
+		if createdAfter, err = time.Parse(time.RFC3339, payload.CreatedAfter); err != nil {
+			return nil, &requestError{http.StatusBadRequest, "created_after must be an RFC 3339 time"}
+		}
 	}
 
-	// Setup the Lazada client
-	appKey := "131151"
-	appSecret := "pA96smss38jIXWepIxl34VtfVMaDrChx"
-	clientOptions := iop.ClientOptions{
-		APIKey:    appKey,
-		APISecret: appSecret,
-		Region:    "MY",
+	accessToken, err := s.accessToken(payload)
+	if errors.Is(err, iop.ErrTokenNotFound) {
+		return nil, &requestError{http.StatusNotFound, "No token stored for seller"}
+	}
+	if errors.Is(err, iop.ErrInvalidToken) {
+		return nil, &requestError{http.StatusUnauthorized, "Stored token has expired, seller must re-authorize"}
+	}
+	if err != nil {
+		log.Printf("Error loading token for seller %s: %v", payload.SellerID, err)
+		return nil, &requestError{http.StatusInternalServerError, "Failed to load token"}
+	}
+
+	// Resolve where the records go before fetching anything
+	sink, err := s.sinks.get(payload.Sink, endpoint.Kind, payload.SellerID, s.country(payload))
+	if err != nil {
+		log.Printf("Error opening sink %q: %v", payload.Sink, err)
+		return nil, &requestError{http.StatusBadRequest, "Invalid sink"}
 	}
 
-	client := iop.NewClient(&clientOptions)
-	client.SetAccessToken(payload.AccessToken)
+	var sync *syncState
+	if payload.Incremental {
+		if sync, err = s.syncState(endpoint, payload, createdAfter); err != nil {
+			return nil, err
+		}
+	}
+
+	// One client is shared by every worker, each call builds its own request
+	client := iop.NewClient(&s.ClientOptions)
+	client.SetAccessToken(accessToken)
+
+	return &processRequest{
+		endpoint:     endpoint,
+		payload:      payload,
+		createdAfter: createdAfter,
+		client:       client,
+		sink:         sink,
+		sync:         sync,
+	}, nil
+}
+
+// syncState loads the cursor of an incremental run, the first run starts
+// at the payload's created_after
+func (s *Service) syncState(endpoint Endpoint, payload *RequestPayload, createdAfter time.Time) (*syncState, error) {
+	if payload.SellerID == "" {
+		return nil, &requestError{http.StatusBadRequest, "Incremental sync requires seller_id"}
+	}
 
-	// Get total order count
-	client.AddAPIParam("created_after", payload.CreatedAfter)
+	// Two runs from the same cursor would overwrite each other's progress
+	country := s.country(payload)
+	key := cursorKey(endpoint.Kind, payload.SellerID, country)
+	if !s.startSync(key) {
+		return nil, &requestError{http.StatusConflict, "An incremental sync of this seller is already running"}
+	}
 
-	// Get total count
-	totalCount, err := getTotalCount(client, endpoint, countKey)
+	cursor, err := s.Cursors.Get(endpoint.Kind, payload.SellerID, country)
+	if errors.Is(err, errCursorNotFound) {
+		if createdAfter.IsZero() {
+			s.endSync(key)
+			return nil, &requestError{http.StatusBadRequest, "First incremental sync requires created_after"}
+		}
+		cursor, err = &Cursor{
+			Kind:         endpoint.Kind,
+			SellerID:     payload.SellerID,
+			Country:      country,
+			UpdatedAfter: createdAfter,
+			Seen:         map[string]time.Time{},
+		}, nil
+	}
 	if err != nil {
-		log.Printf("Error fetching total count: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch count"})
+		log.Printf("Error loading cursor for seller %s: %v", payload.SellerID, err)
+		s.endSync(key)
+		return nil, &requestError{http.StatusInternalServerError, "Failed to load sync cursor"}
 	}
 
-	log.Printf("Payload: %+v", payload)
-	log.Printf("Total items to process: %d", totalCount)
+	return &syncState{
+		store:   s.Cursors,
+		overlap: s.SyncOverlap,
+		next:    cursor,
+		done:    func() { s.endSync(key) },
+	}, nil
+}
 
-	// Worker pool and concurrency setup
-	limit := 18
-	numWorkers := 5 // Adjust based on system resources
-	tasks := make(chan Task, totalCount)
-	results := make(chan string, totalCount)
-	var wg sync.WaitGroup
+// startSync marks the incremental run of key as started, it reports false
+// if one is already running
+func (s *Service) startSync(key string) bool {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if s.syncing[key] {
+		return false
+	}
+	if s.syncing == nil {
+		s.syncing = map[string]bool{}
+	}
+	s.syncing[key] = true
+	return true
+}
 
-	// Start worker goroutines
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		config := WorkerConfig{
-			ClientOptions: clientOptions,
-			AccessToken:   payload.AccessToken,
-			CreatedAfter:  payload.CreatedAfter,
-			Endpoint:      endpoint,
-			ProcessFunc:   processFunc,
-		}
-		go worker(config, tasks, results, &wg, endpoint)
+func (s *Service) endSync(key string) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	delete(s.syncing, key)
+}
+
+func respondError(c echo.Context, err error) error {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		return c.JSON(reqErr.status, map[string]string{"error": reqErr.message})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// process fetches every page of r, processes it and hands it to the sink.
+// onStart is called once the total is known, onPage after every page.
+func (s *Service) process(ctx context.Context, r *processRequest, onStart func(total, pages int), onPage func(pageResult)) error {
+	if r.sync != nil {
+		return s.processIncremental(ctx, r, onStart, onPage)
 	}
 
-	// Send tasks to the worker pool
-	for offset := 0; offset < totalCount; offset += limit {
-		tasks <- Task{Offset: offset, Limit: limit}
+	pageSize := r.endpoint.PageSize
+	concurrency := 5 // Adjust based on system resources
+
+	// Fetch the total count, then fan out one request per page
+	pagination, err := iop.Paginate(ctx, r.client, r.endpoint.Path,
+		r.endpoint.Params(r.createdAfter),
+		iop.PaginateOptions{
+			CountPath:   r.endpoint.CountKey,
+			PageSize:    pageSize,
+			Concurrency: concurrency,
+		})
+	if err != nil {
+		return fmt.Errorf("fetching total count: %w", err)
 	}
-	close(tasks)
 
-	// Wait for all workers to complete
-	wg.Wait()
-	close(results)
+	log.Printf("Seller: %q, created after: %q", r.payload.SellerID, r.payload.CreatedAfter)
+	log.Printf("Total items to process: %d", pagination.Total)
+	onStart(pagination.Total, (pagination.Total+pageSize-1)/pageSize)
 
-	// Process results
+	// Process the fetched pages using the provided processFunc and hand
+	// every page to the sink as soon as it is ready. Processing enriches
+	// pages with further calls, so it runs on as many workers as there are
+	// fetches in flight, while onPage is only called from this goroutine.
+	// Full runs have no sync state, the filtering of incremental runs stays
+	// serialized in processIncremental.
+	results := make(chan pageResult)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pagination.Pages {
+				results <- s.handlePage(ctx, r, page)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 	for result := range results {
-		log.Printf("Processed data: %s", result)
+		onPage(result)
 	}
 
-	// Return success response
-	log.Println("Items processed successfully")
-	return c.JSON(http.StatusOK, map[string]string{"message": "Items processed successfully"})
+	return ctx.Err()
 }
 
-func getTotalCount(client *iop.IopClient, endpoint, countKey string) (int, error) {
-	getResult, err := client.Execute(endpoint, "GET", nil)
-	if err != nil {
-		return 0, err
+// handlePage processes a fetched page and hands its records to the sink,
+// incremental runs only keep the new and changed records
+func (s *Service) handlePage(ctx context.Context, r *processRequest, page iop.Page) pageResult {
+	result := pageResult{Offset: page.Offset}
+	switch {
+	case page.Err != nil:
+		result.Err = fmt.Errorf("fetching offset %d: %w", page.Offset, page.Err)
+	default:
+		result.Records, result.Err = r.endpoint.Process(ctx, r.client, string(page.Response.Data))
+		if result.Err != nil {
+			result.Err = fmt.Errorf("processing offset %d: %w", page.Offset, result.Err)
+			break
+		}
+		if r.sync != nil {
+			result.Records = r.sync.filter(result.Records)
+		}
+		if r.sink != nil {
+			if err := r.sink.Write(ctx, result.Records); err != nil {
+				result.Err = fmt.Errorf("writing offset %d: %w", page.Offset, err)
+			}
+		}
 	}
-
-	response := string(getResult.Data)
-	return int(gjson.Get(response, countKey).Int()), nil
+	if result.Err != nil {
+		log.Printf("Error: %v", result.Err)
+	}
+	return result
 }
 
-func worker(config WorkerConfig, tasks <-chan Task, results chan<- string, wg *sync.WaitGroup, endpoint string) {
-	defer wg.Done()
-	log.Printf(config.CreatedAfter)
+// handleProcessing starts a job and returns its ID right away, the caller
+// polls GET /jobs/:id for progress
+func (s *Service) handleProcessing(c echo.Context, endpoint Endpoint) error {
+	r, err := s.prepare(c, endpoint)
+	if err != nil {
+		return respondError(c, err)
+	}
 
-	for task := range tasks {
-		client := iop.NewClient(&config.ClientOptions)
-		client.SetAccessToken(config.AccessToken)
-		client.AddAPIParam("created_after", config.CreatedAfter)
-		client.AddAPIParam("offset", fmt.Sprintf("%d", task.Offset))
-		client.AddAPIParam("limit", fmt.Sprintf("%d", task.Limit))
+	job := s.jobs.Start(endpoint.Kind, func(ctx context.Context, job *Job) error {
+		return s.process(ctx, r, job.setTotal, job.addPage)
+	})
 
-		getResult, err := client.Execute(endpoint, "GET", nil)
-		if err != nil {
-			log.Printf("Error fetching data for offset %d: %v", task.Offset, err)
-			continue
-		}
+	c.Response().Header().Set(echo.HeaderLocation, "/jobs/"+job.ID)
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"job_id":     job.ID,
+		"status_url": "/jobs/" + job.ID,
+	})
+}
 
-		// Process the fetched data using the provided ProcessFunc
-		processedData := config.ProcessFunc(string(getResult.Data))
+func (s *Service) handleGetJob(c echo.Context) error {
+	job, ok := s.jobs.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
+	}
+	return c.JSON(http.StatusOK, job.Snapshot())
+}
 
-		results <- processedData
+func (s *Service) handleCancelJob(c echo.Context) error {
+	job, ok := s.jobs.Cancel(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job not found"})
 	}
+	return c.JSON(http.StatusAccepted, job.Snapshot())
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the normalized records of a processing run, page by page.
+// Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, records []interface{}) error
+	Close() error
+}
+
+// CSVRecord is implemented by records that can be written by CSVSink
+type CSVRecord interface {
+	CSVHeader() []string
+	CSVRow() []string
+}
+
+// Sink names accepted in SinkConfig.Default and RequestPayload.Sink
+const (
+	SinkNone    = "none"
+	SinkNDJSON  = "ndjson"
+	SinkCSV     = "csv"
+	SinkWebhook = "webhook"
+)
+
+// SinkConfig configures where processed records land
+type SinkConfig struct {
+	// Default is the sink used when the request does not pick one
+	Default string
+	// Dir holds the file sinks, one <kind>-<seller>-<country>.ndjson or
+	// .csv per kind and seller
+	Dir string
+	// WebhookURL receives the records of every page along with the kind,
+	// seller and country they belong to
+	WebhookURL string
+}
+
+// sinks opens each configured sink once and shares it between requests
+type sinks struct {
+	config SinkConfig
+
+	mu    sync.Mutex
+	open  map[string]Sink
+	httpc *http.Client
+}
+
+func newSinks(config SinkConfig) *sinks {
+	return &sinks{
+		config: config,
+		open:   map[string]Sink{},
+		httpc:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// get returns the sink called name for the records of kind, e.g. "orders",
+// of one seller. A nil Sink means the records are only logged.
+func (s *sinks) get(name, kind, sellerID, country string) (Sink, error) {
+	if name == "" {
+		name = s.config.Default
+	}
+	if name == "" || name == SinkNone {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	country = strings.ToUpper(country)
+	key := name + "/" + kind + "/" + sellerID + "/" + country
+	if sink, ok := s.open[key]; ok {
+		return sink, nil
+	}
+
+	var sink Sink
+	var err error
+	switch name {
+	case SinkNDJSON:
+		sink, err = NewNDJSONSink(s.filePath(kind, sellerID, country, ".ndjson"))
+	case SinkCSV:
+		sink, err = NewCSVSink(s.filePath(kind, sellerID, country, ".csv"))
+	case SinkWebhook:
+		if s.config.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook sink is not configured")
+		}
+		sink = &WebhookSink{URL: s.config.WebhookURL, Kind: kind, SellerID: sellerID, Country: country, Client: s.httpc}
+	default:
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.open[key] = sink
+	return sink, nil
+}
+
+// filePath returns the file of a file sink. Runs with only an access token
+// have no seller ID, their records go to <kind>-<country>.
+func (s *sinks) filePath(kind, sellerID, country, ext string) string {
+	name := kind
+	if sellerID != "" {
+		// Seller IDs come from the request, keep them inside Dir
+		name += "-" + url.PathEscape(sellerID)
+	}
+	return filepath.Join(s.config.Dir, name+"-"+url.PathEscape(country)+ext)
+}
+
+func openAppend(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+}
+
+// NDJSONSink appends one JSON document per record to a file
+type NDJSONSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewNDJSONSink opens path for appending
+func NewNDJSONSink(path string) (*NDJSONSink, error) {
+	file, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONSink{file: file}, nil
+}
+
+// Write implements Sink, a page is written in a single call so that
+// concurrent pages never interleave
+func (s *NDJSONSink) Write(_ context.Context, records []interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.file.Write(buf.Bytes())
+	return err
+}
+
+// Close implements Sink
+func (s *NDJSONSink) Close() error {
+	return s.file.Close()
+}
+
+// CSVSink appends one row per record to a file, the header is written
+// when the file is empty. Records must implement CSVRecord.
+type CSVSink struct {
+	mu        sync.Mutex
+	file      *os.File
+	hasHeader bool
+}
+
+// NewCSVSink opens path for appending
+func NewCSVSink(path string) (*CSVSink, error) {
+	file, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &CSVSink{file: file, hasHeader: info.Size() > 0}, nil
+}
+
+// Write implements Sink
+func (s *CSVSink) Write(_ context.Context, records []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := bufio.NewWriter(s.file)
+	w := csv.NewWriter(buf)
+	for _, record := range records {
+		row, ok := record.(CSVRecord)
+		if !ok {
+			return fmt.Errorf("csv sink: %T has no CSV form", record)
+		}
+		if !s.hasHeader {
+			if err := w.Write(row.CSVHeader()); err != nil {
+				return err
+			}
+			s.hasHeader = true
+		}
+		if err := w.Write(row.CSVRow()); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// Close implements Sink
+func (s *CSVSink) Close() error {
+	return s.file.Close()
+}
+
+// WebhookSink POSTs every page as
+// {"kind": ..., "seller_id": ..., "country": ..., "records": [...]}
+type WebhookSink struct {
+	URL      string
+	Kind     string
+	SellerID string
+	Country  string
+	Client   *http.Client
+}
+
+// Write implements Sink
+func (s *WebhookSink) Write(ctx context.Context, records []interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"kind":      s.Kind,
+		"seller_id": s.SellerID,
+		"country":   s.Country,
+		"records":   records,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Close implements Sink
+func (s *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Stream event types
+const (
+	eventStart    = "start"
+	eventPage     = "page"
+	eventProgress = "progress"
+	eventError    = "error"
+	eventDone     = "done"
+)
+
+// streamWriter writes events as Server-Sent Events or as NDJSON lines of
+// {"event": ..., "data": ...}, flushing after each one. Writes block on a
+// slow client, which in turn holds back the page fetching, so nothing is
+// buffered beyond the paginator's in-flight pages.
+type streamWriter struct {
+	resp   *echo.Response
+	sse    bool
+	cancel context.CancelFunc
+	failed bool
+}
+
+func (w *streamWriter) event(name string, data interface{}) {
+	if w.failed {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err == nil {
+		if w.sse {
+			_, err = fmt.Fprintf(w.resp, "event: %s\ndata: %s\n\n", name, payload)
+		} else {
+			_, err = fmt.Fprintf(w.resp, "{\"event\":%q,\"data\":%s}\n", name, payload)
+		}
+	}
+	if err != nil {
+		// The client is gone, stop fetching pages nobody will read
+		log.Printf("Error writing stream event: %v", err)
+		w.failed = true
+		w.cancel()
+		return
+	}
+	w.resp.Flush()
+}
+
+func wantsSSE(c echo.Context) bool {
+	switch c.QueryParam("format") {
+	case "sse":
+		return true
+	case "ndjson":
+		return false
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+}
+
+// handleStream processes like handleProcessing but streams every page to
+// the caller as soon as it is produced, along with progress events
+func (s *Service) handleStream(c echo.Context, endpoint Endpoint) error {
+	r, err := s.prepare(c, endpoint)
+	if err != nil {
+		return respondError(c, err)
+	}
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	w := &streamWriter{resp: c.Response(), sse: wantsSSE(c), cancel: cancel}
+	header := w.resp.Header()
+	if w.sse {
+		header.Set(echo.HeaderContentType, "text/event-stream")
+	} else {
+		header.Set(echo.HeaderContentType, "application/x-ndjson")
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.resp.WriteHeader(http.StatusOK)
+
+	pagesTotal, pagesDone, records, errorCount := 0, 0, 0, 0
+	err = s.process(ctx, r,
+		func(total, pages int) {
+			pagesTotal = pages
+			w.event(eventStart, map[string]interface{}{
+				"kind":        endpoint.Kind,
+				"total_items": total,
+				"pages_total": pages,
+			})
+		},
+		func(page pageResult) {
+			pagesDone++
+			records += len(page.Records)
+			if page.Err != nil {
+				errorCount++
+				w.event(eventError, map[string]interface{}{
+					"offset": page.Offset,
+					"error":  page.Err.Error(),
+				})
+			} else {
+				w.event(eventPage, map[string]interface{}{
+					"offset":  page.Offset,
+					"records": page.Records,
+				})
+			}
+			w.event(eventProgress, map[string]interface{}{
+				"pages_done":  pagesDone,
+				"pages_total": pagesTotal,
+				"records":     records,
+			})
+		})
+	if err != nil {
+		errorCount++
+		w.event(eventError, map[string]interface{}{"error": err.Error()})
+	}
+
+	w.event(eventDone, map[string]interface{}{
+		"pages_done":  pagesDone,
+		"pages_total": pagesTotal,
+		"records":     records,
+		"error_count": errorCount,
+	})
+	return nil
+}
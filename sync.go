@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"lazada/iop-sdk-go/iop"
+
+	"github.com/tidwall/gjson"
+)
+
+// minSyncWindow is the narrowest update window of an incremental run, a
+// window with more updates than a page is paged by offset
+const minSyncWindow = 2 * time.Second
+
+// SyncRecord is implemented by records that can be processed incrementally
+type SyncRecord interface {
+	RecordID() string
+	RecordUpdatedAt() time.Time
+}
+
+// syncState tracks one incremental run. The cursor only advances once
+// every page went through, a failed run is simply repeated.
+type syncState struct {
+	store   CursorStore
+	overlap time.Duration
+	next    *Cursor
+	// hold is the start of the first window that changed while it was
+	// paged by offset, the cursor never moves past it
+	hold time.Time
+	// done is called once the run is over, whether it succeeded or not
+	done func()
+}
+
+// updateAfter returns the update_after to query with, overlap before the
+// high-water mark so that late writes are picked up
+func (s *syncState) updateAfter() time.Time {
+	return s.next.UpdatedAfter.Add(-s.overlap)
+}
+
+// filter returns the records that are new or changed since they were last
+// emitted, including earlier pages of the same run
+func (s *syncState) filter(records []interface{}) []interface{} {
+	changed := records[:0:0]
+	for _, record := range records {
+		sr, ok := record.(SyncRecord)
+		if !ok || sr.RecordUpdatedAt().IsZero() {
+			changed = append(changed, record)
+			continue
+		}
+
+		id, updatedAt := sr.RecordID(), sr.RecordUpdatedAt()
+		if seen, ok := s.next.Seen[id]; ok && !updatedAt.After(seen) {
+			continue
+		}
+		s.next.Seen[id] = updatedAt
+		if updatedAt.After(s.next.UpdatedAfter) {
+			s.next.UpdatedAfter = updatedAt
+		}
+		changed = append(changed, record)
+	}
+	return changed
+}
+
+// holdAt keeps the cursor from moving past t
+func (s *syncState) holdAt(t time.Time) {
+	if s.hold.IsZero() || t.Before(s.hold) {
+		s.hold = t
+	}
+}
+
+// commit drops the records that fell out of the overlap window and stores
+// the cursor
+func (s *syncState) commit() error {
+	if !s.hold.IsZero() && s.next.UpdatedAfter.After(s.hold.Add(s.overlap)) {
+		s.next.UpdatedAfter = s.hold.Add(s.overlap)
+	}
+
+	cutoff := s.updateAfter()
+	for id, t := range s.next.Seen {
+		if t.Before(cutoff) {
+			delete(s.next.Seen, id)
+		}
+	}
+	return s.store.Put(s.next)
+}
+
+// processIncremental fetches the updates since the cursor window by window
+// of update time, each window narrowed until its updates fit in a single
+// page. Offsets are avoided because a record updated during the run leaves
+// its position and shifts the ones after it, so a record at a page boundary
+// would never be fetched. Windows overlap by a second, whatever the
+// gateway's boundary semantics, the repeated records are filtered out.
+func (s *Service) processIncremental(ctx context.Context, r *processRequest, onStart func(total, pages int), onPage func(pageResult)) error {
+	defer r.sync.done()
+	pageSize := r.endpoint.PageSize
+
+	fetch := func(from, to time.Time, offset, limit int) (*iop.Response, int, error) {
+		resp, err := r.client.NewRequest(r.endpoint.Path).
+			Params(r.endpoint.IncrementalParams(from, to)).
+			Param("offset", strconv.Itoa(offset)).
+			Param("limit", strconv.Itoa(limit)).
+			Do(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		return resp, int(gjson.GetBytes(resp.Data, r.endpoint.CountKey).Int()), nil
+	}
+
+	// Updates landing during the run are left to the next one
+	from, end := r.sync.updateAfter(), time.Now()
+	_, total, err := fetch(from, end, 0, 1)
+	if err != nil {
+		return fmt.Errorf("fetching total count: %w", err)
+	}
+
+	log.Printf("Incremental sync of %s for seller %q, %d updated since %s", r.endpoint.Kind, r.payload.SellerID, total, iop.FormatTime(from))
+	onStart(total, (total+pageSize-1)/pageSize)
+
+	offset := 0
+	window := end.Sub(from)
+	for {
+		if window < minSyncWindow {
+			window = minSyncWindow
+		}
+		to := from.Add(window)
+		if to.After(end) {
+			to = end
+		}
+
+		resp, count, err := fetch(from, to, 0, pageSize)
+		if err == nil && count > pageSize && to.Sub(from) > minSyncWindow {
+			window = to.Sub(from) / 2
+			continue
+		}
+
+		for windowOffset := 0; ; windowOffset += pageSize {
+			if windowOffset > 0 {
+				resp, _, err = fetch(from, to, windowOffset, pageSize)
+			}
+			result := s.handlePage(ctx, r, iop.Page{Offset: offset, Limit: pageSize, Response: resp, Err: err})
+			onPage(result)
+			if result.Err != nil {
+				// The window is incomplete, the next run starts over from
+				// the stored cursor
+				log.Printf("Not advancing the %s cursor of seller %q, a page failed", r.endpoint.Kind, r.payload.SellerID)
+				return ctx.Err()
+			}
+			offset += pageSize
+			if windowOffset+pageSize >= count {
+				break
+			}
+		}
+
+		if count > pageSize {
+			// Too dense to narrow further, so the window was paged by
+			// offset. Its offsets only shift when a record left it during
+			// the run, which changes its count, and the cursor then holds
+			// so that the next run fetches the window again.
+			if _, recount, err := fetch(from, to, 0, 1); err != nil || recount != count {
+				log.Printf("%s updated within %s of %s changed while paging, holding the cursor", r.endpoint.Kind, minSyncWindow, iop.FormatTime(from))
+				r.sync.holdAt(from)
+			}
+		}
+
+		if !to.Before(end) {
+			break
+		}
+		from = to.Add(-time.Second)
+		window *= 2
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := r.sync.commit(); err != nil {
+		return fmt.Errorf("saving sync cursor: %w", err)
+	}
+	return nil
+}
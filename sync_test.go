@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lazada/iop-sdk-go/iop"
+	"lazada/pkg/order"
+)
+
+// fakeOrders is a gateway serving /orders/get filtered by update window,
+// sorted by update time and paged by offset
+type fakeOrders struct {
+	mu      sync.Mutex
+	updated map[int]time.Time
+	// onPage is called for every page request with its offset, under mu
+	onPage func(offset int)
+}
+
+func (g *fakeOrders) RoundTrip(req *http.Request) (*http.Response, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	body := `{"code":"0","data":[]}`
+	if strings.HasSuffix(req.URL.Path, "/orders/get") {
+		q := req.URL.Query()
+		after, _ := time.Parse(time.RFC3339, q.Get("update_after"))
+		before, _ := time.Parse(time.RFC3339, q.Get("update_before"))
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		if limit > 1 && g.onPage != nil {
+			g.onPage(offset)
+		}
+
+		var ids []int
+		for id, t := range g.updated {
+			if !t.Before(after) && t.Before(before) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			ti, tj := g.updated[ids[i]], g.updated[ids[j]]
+			return ti.Before(tj) || ti.Equal(tj) && ids[i] < ids[j]
+		})
+
+		var rows []string
+		for i := offset; i < offset+limit && i < len(ids); i++ {
+			rows = append(rows, fmt.Sprintf(`{"order_id":%d,"order_number":"%d","updated_at":%q}`,
+				ids[i], ids[i], g.updated[ids[i]].Format("2006-01-02 15:04:05 -0700")))
+		}
+		body = fmt.Sprintf(`{"code":"0","data":{"countTotal":%d,"orders":[%s]}}`, len(ids), strings.Join(rows, ","))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+// newSyncService returns a service syncing orders from gateway with a
+// cursor store in a temporary directory
+func newSyncService(t *testing.T, gateway http.RoundTripper) *Service {
+	t.Helper()
+	cursors, err := NewFileCursorStore(filepath.Join(t.TempDir(), "cursors.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := newClientOptions()
+	opts.Transport = gateway
+	opts.Retry = nil
+	return &Service{ClientOptions: opts, Cursors: cursors, SyncOverlap: 10 * time.Minute}
+}
+
+// runSync runs one incremental sync of seller s1 and returns how many
+// times each order was emitted
+func runSync(t *testing.T, svc *Service, createdAfter time.Time) map[string]int {
+	t.Helper()
+	payload := &RequestPayload{AccessToken: "test-token", SellerID: "s1", Incremental: true}
+	state, err := svc.syncState(ordersEndpoint, payload, createdAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := iop.NewClient(&svc.ClientOptions)
+	client.SetAccessToken(payload.AccessToken)
+	r := &processRequest{endpoint: ordersEndpoint, payload: payload, client: client, sync: state}
+
+	emitted := map[string]int{}
+	err = svc.processIncremental(context.Background(), r, func(int, int) {}, func(page pageResult) {
+		if page.Err != nil {
+			t.Errorf("page at offset %d: %v", page.Offset, page.Err)
+		}
+		for _, record := range page.Records {
+			emitted[record.(order.NormalizedOrder).OrderID]++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emitted
+}
+
+// newBurst returns 20 orders spread over the last day and 150 updated in
+// the same second, more than a page
+func newBurst(now time.Time) (updated map[int]time.Time, burst, latest time.Time) {
+	updated = map[int]time.Time{}
+	start := now.Add(-24 * time.Hour).Truncate(time.Second)
+	burst = start.Add(6 * time.Hour)
+	for id := 0; id < 20; id++ {
+		updated[id] = start.Add(time.Duration(id) * time.Hour)
+	}
+	for id := 20; id < 170; id++ {
+		updated[id] = burst
+	}
+	return updated, burst, updated[19]
+}
+
+func TestIncrementalDenseWindow(t *testing.T) {
+	updated, burst, latest := newBurst(time.Now())
+	svc := newSyncService(t, &fakeOrders{updated: updated})
+	createdAfter := burst.Add(-12 * time.Hour)
+
+	if emitted := runSync(t, svc, createdAfter); len(emitted) != 170 {
+		t.Fatalf("first run emitted %d orders, want 170", len(emitted))
+	}
+	cursor, err := svc.Cursors.Get("orders", "s1", "MY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.UpdatedAfter.Equal(latest) {
+		t.Errorf("cursor at %s, want it past the burst at %s", cursor.UpdatedAfter, latest)
+	}
+
+	if emitted := runSync(t, svc, createdAfter); len(emitted) != 0 {
+		t.Errorf("second run emitted %d orders, want none", len(emitted))
+	}
+	cursor, err = svc.Cursors.Get("orders", "s1", "MY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cursor.Seen) != 1 {
+		t.Errorf("cursor remembers %d orders, want only the one in the overlap", len(cursor.Seen))
+	}
+}
+
+func TestIncrementalHoldsShiftedWindow(t *testing.T) {
+	updated, burst, _ := newBurst(time.Now())
+	gateway := &fakeOrders{updated: updated}
+	// The first order of the burst is updated while the second page of the
+	// burst is fetched, the orders after it shift by one
+	gateway.onPage = func(offset int) {
+		if offset > 0 && gateway.updated[20].Equal(burst) {
+			gateway.updated[20] = time.Now().Truncate(time.Second)
+		}
+	}
+	svc := newSyncService(t, gateway)
+	createdAfter := burst.Add(-12 * time.Hour)
+
+	first := runSync(t, svc, createdAfter)
+	cursor, err := svc.Cursors.Get("orders", "s1", "MY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.UpdatedAfter.After(burst.Add(svc.SyncOverlap)) {
+		t.Errorf("cursor moved to %s, past the shifted window at %s", cursor.UpdatedAfter, burst)
+	}
+
+	// The updated order lands after the first run's end
+	time.Sleep(time.Second)
+	second := runSync(t, svc, createdAfter)
+	for id := range second {
+		first[id]++
+	}
+	if len(first) != 170 {
+		t.Errorf("both runs emitted %d orders, want 170", len(first))
+	}
+	if second["20"] != 1 {
+		t.Error("second run did not emit the updated order")
+	}
+}
+
+func TestIncrementalRejectsConcurrentRun(t *testing.T) {
+	svc := newSyncService(t, &fakeOrders{})
+	payload := &RequestPayload{AccessToken: "test-token", SellerID: "s1", Incremental: true}
+	createdAfter := time.Now().Add(-time.Hour)
+
+	running, err := svc.syncState(ordersEndpoint, payload, createdAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.syncState(ordersEndpoint, payload, createdAfter)
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) || reqErr.status != http.StatusConflict {
+		t.Fatalf("second run got %v, want a conflict", err)
+	}
+
+	// Other kinds of the same seller are independent
+	state, err := svc.syncState(productsEndpoint, payload, createdAfter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.done()
+
+	running.done()
+	if _, err := svc.syncState(ordersEndpoint, payload, createdAfter); err != nil {
+		t.Errorf("run after the first one finished got %v", err)
+	}
+}
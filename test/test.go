@@ -1,16 +1,13 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net/http"
-	"sync"
 
 	"lazada/iop-sdk-go/iop"
 	"lazada/pkg/order"
 
 	"github.com/labstack/echo/v4"
-	"github.com/tidwall/gjson"
 )
 
 type RequestPayload struct {
@@ -18,11 +15,6 @@ type RequestPayload struct {
 	CreatedAfter string `json:"created_after"`
 }
 
-type OrderTask struct {
-	Offset int
-	Limit  int
-}
-
 func main() {
 	e := echo.New()
 
@@ -68,77 +60,36 @@ func handleOrderProcessing(c echo.Context) error {
 	client := iop.NewClient(&clientOptions)
 	client.SetAccessToken(payload.AccessToken)
 
-	// Get total order count
-	client.AddAPIParam("created_after", payload.CreatedAfter)
-	totalOrders, err := getTotalOrderCount(client)
+	// Get total orders count, then fan out one request per page
+	pagination, err := iop.Paginate(c.Request().Context(), client, "/orders/get",
+		map[string]string{"created_after": payload.CreatedAfter},
+		iop.PaginateOptions{
+			CountPath:   "countTotal",
+			PageSize:    18,
+			Concurrency: 5, // Adjust based on system resources
+		})
 	if err != nil {
 		log.Printf("Error fetching total orders: %v", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch order count"})
 	}
 
-	log.Printf("Payload: %+v", payload)
-
-	log.Printf("Total orders to process: %d", totalOrders)
-
-	// Worker pool and concurrency setup
-	limit := 18
-	numWorkers := 5 // Adjust based on system resources
-	tasks := make(chan OrderTask, totalOrders)
-	results := make(chan string, totalOrders)
-	var wg sync.WaitGroup
-
-	// Start worker goroutines
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go worker(clientOptions, payload.AccessToken, payload.CreatedAfter, tasks, results, &wg)
-	}
-
-	// Send tasks to the worker pool
-	for offset := 0; offset < totalOrders; offset += limit {
-		tasks <- OrderTask{Offset: offset, Limit: limit}
-	}
-	close(tasks)
-
-	// Wait for all workers to complete
-	wg.Wait()
-	close(results)
+	log.Printf("Total orders to process: %d", pagination.Total)
 
 	// Process results
-	for result := range results {
-		order.ProcessOrders(result)
+	for page := range pagination.Pages {
+		if page.Err != nil {
+			log.Printf("Error fetching orders for offset %d: %v", page.Offset, page.Err)
+			continue
+		}
+		orders, err := order.ProcessOrders(string(page.Response.Data))
+		if err != nil {
+			log.Printf("Error processing orders for offset %d: %v", page.Offset, err)
+			continue
+		}
+		log.Printf("Processed %d orders", len(orders))
 	}
 
 	// Return success response
 	log.Println("Orders processed successfully")
 	return c.JSON(http.StatusOK, map[string]string{"message": "Orders processed successfully"})
 }
-
-func getTotalOrderCount(client *iop.IopClient) (int, error) {
-	getResult, err := client.Execute("/orders/get", "GET", nil)
-	if err != nil {
-		return 0, err
-	}
-
-	response := string(getResult.Data)
-	return int(gjson.Get(response, "countTotal").Int()), nil
-}
-
-func worker(clientOptions iop.ClientOptions, accessToken string, CreatedAfter string, tasks <-chan OrderTask, results chan<- string, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for task := range tasks {
-		client := iop.NewClient(&clientOptions)
-		client.SetAccessToken(accessToken)
-		client.AddAPIParam("created_after", CreatedAfter)
-		client.AddAPIParam("offset", fmt.Sprintf("%d", task.Offset))
-		client.AddAPIParam("limit", fmt.Sprintf("%d", task.Limit))
-
-		getResult, err := client.Execute("/orders/get", "GET", nil)
-		if err != nil {
-			log.Printf("Error fetching orders for offset %d: %v", task.Offset, err)
-			continue
-		}
-
-		results <- string(getResult.Data)
-	}
-}